@@ -0,0 +1,83 @@
+// Package amplitude implements amplitude estimation algorithms.
+package amplitude
+
+import (
+	"math/rand"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// Problem is an amplitude estimation problem.
+// A prepares A|0> = sqrt(1-a)|bad> + sqrt(a)|good>, and Good returns true for good basis states.
+// The amplitude to estimate is a, which is the probability of measuring a good state.
+type Problem struct {
+	A    qsim.Gate
+	Good func(int) bool
+}
+
+// Size returns the number of qubits of this problem.
+func (p Problem) Size() int {
+	return p.A.Size()
+}
+
+// Grover returns the Grover operator Q = -A S_0 A^dagger S_good,
+// where S_0 and S_good flip the sign of |0> and good states respectively.
+// Q has eigenvalues exp(+-2i theta), where a = sin^2(theta).
+func (p Problem) Grover() qsim.Gate {
+	dim := 1 << p.Size()
+	A := p.A.ToMat()
+
+	S0 := mat.NewId(dim)
+	S0[0][0] = -1
+
+	Sgood := mat.NewId(dim)
+	for n := 0; n < dim; n++ {
+		if p.Good(n) {
+			Sgood[n][n] = -1
+		}
+	}
+
+	return qsim.NewGate(A.Mul(S0).Mul(A.Dagger()).Mul(Sgood).ScalarMul(-1))
+}
+
+// run returns the circuit with state Q^k A|0>.
+func (p Problem) run(Q qsim.Gate, k int) *qsim.Circuit {
+	regs := slice.Range(0, p.Size())
+
+	c := qsim.NewCircuit(p.Size())
+	c.Apply(p.A, regs...)
+	for i := 0; i < k; i++ {
+		c.Apply(Q, regs...)
+	}
+
+	return c
+}
+
+// goodProb returns the probability of measuring a good state from c.
+func (p Problem) goodProb(c *qsim.Circuit) float64 {
+	q := c.State()
+
+	r := 0.0
+	for n := 0; n < q.Dim(); n++ {
+		if p.Good(n) {
+			a := q.At(n)
+			r += real(a)*real(a) + imag(a)*imag(a)
+		}
+	}
+
+	return r
+}
+
+// sample returns the number of good outcomes, by measuring shots times with good probability prob.
+func sample(prob float64, shots int) int {
+	r := 0
+	for i := 0; i < shots; i++ {
+		if rand.Float64() < prob {
+			r++
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,74 @@
+package amplitude_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/algorithms/amplitude"
+	"github.com/sp301415/qsim/math/mat"
+)
+
+// ry returns the RY(theta) gate.
+func ry(theta float64) qsim.Gate {
+	c := complex(math.Cos(theta/2), 0)
+	s := complex(math.Sin(theta/2), 0)
+	return qsim.NewGate(mat.NewMatVars(2, c, -s, s, c))
+}
+
+// bernoulli returns the problem with amplitude sin^2(theta).
+func bernoulli(theta float64) amplitude.Problem {
+	return amplitude.Problem{A: ry(2 * theta), Good: func(x int) bool { return x == 1 }}
+}
+
+func TestGrover(t *testing.T) {
+	theta := 0.3
+	p := bernoulli(theta)
+
+	// Q rotates by 2 theta.
+	if !p.Grover().ToMat().Equals(ry(4 * theta).ToMat()) {
+		t.Fail()
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	// theta = pi/8 is exactly representable with 3 evaluation qubits.
+	theta := math.Pi / 8
+	a := amplitude.Canonical(bernoulli(theta), 3)
+
+	if math.Abs(a-math.Pow(math.Sin(theta), 2)) > 1e-9 {
+		t.Fail()
+	}
+}
+
+func TestCounting(t *testing.T) {
+	n := 4
+	// These give phases exactly representable with 4 evaluation qubits.
+	for _, M := range []int{0, 8, 16} {
+		oracle := func(x int) bool { return x < M }
+
+		if amplitude.Counting(n, oracle, 4) != M {
+			t.Fatalf("Expected %d solutions", M)
+		}
+	}
+}
+
+func TestMaximumLikelihood(t *testing.T) {
+	theta := 0.7
+	a := amplitude.MaximumLikelihood(bernoulli(theta), amplitude.ExponentialSchedule(6), 100)
+
+	if math.Abs(a-math.Pow(math.Sin(theta), 2)) > 0.01 {
+		t.Fail()
+	}
+}
+
+func TestIterative(t *testing.T) {
+	theta := 0.4
+	eps := 0.005
+	r := amplitude.Iterative(bernoulli(theta), eps, 1e-6, 100)
+
+	a := math.Pow(math.Sin(theta), 2)
+	if r.Low > a || r.High < a || r.High-r.Low > 2*eps {
+		t.Fatal(r)
+	}
+}
@@ -0,0 +1,47 @@
+package amplitude
+
+import (
+	"math"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// Canonical estimates the amplitude using quantum phase estimation with m evaluation qubits,
+// following Brassard, Hoyer, Mosca and Tapp.
+// With probability at least 8/pi^2, the error is at most 2pi sqrt(a(1-a))/2^m + pi^2/4^m.
+func Canonical(p Problem, m int) float64 {
+	n := p.Size()
+	eregs := slice.Range(0, m)
+	sregs := slice.Range(m, m+n)
+
+	c := qsim.NewCircuit(m + n)
+	c.Apply(p.A, sregs...)
+	c.H(eregs...)
+
+	// Controlled Q^(2^j) on jth evaluation qubit.
+	Q := p.Grover()
+	for j := 0; j < m; j++ {
+		c.Control(Q, []int{eregs[j]}, sregs)
+		Q = qsim.NewGate(Q.ToMat().Mul(Q.ToMat()))
+	}
+
+	c.InvQFT(eregs...)
+	y := c.Measure(eregs...)
+
+	// Measured phase is y / 2^m = theta / pi or 1 - theta / pi.
+	s := math.Sin(math.Pi * float64(y) / float64(int(1)<<m))
+	return s * s
+}
+
+// Counting estimates the number of solutions of oracle on n bits, using m evaluation qubits.
+// This is Canonical amplitude estimation with A = H^n.
+func Counting(n int, oracle func(int) bool, m int) int {
+	A := qsim.H()
+	for i := 1; i < n; i++ {
+		A = A.Tensor(qsim.H())
+	}
+
+	a := Canonical(Problem{A: A, Good: oracle}, m)
+	return int(math.Round(a * float64(int(1)<<n)))
+}
@@ -0,0 +1,98 @@
+package amplitude
+
+import (
+	"math"
+)
+
+// Result is the result of iterative amplitude estimation.
+type Result struct {
+	Estimate float64 // Estimated amplitude.
+	Low      float64 // Lower bound of the confidence interval.
+	High     float64 // Upper bound of the confidence interval.
+	Queries  int     // Number of applications of A and Q.
+}
+
+// findNextK returns the largest power k such that (4k+2) theta lies in a single half period,
+// for every theta in [lo, hi]. up tells which half period it is.
+func findNextK(k int, lo, hi float64, up bool) (int, bool) {
+	K := 4*k + 2
+	thetaMin := float64(K) * lo
+	thetaMax := float64(K) * hi
+
+	Kmax := int(math.Floor(math.Pi / (hi - lo)))
+	Knext := Kmax - (Kmax-2)%4
+
+	for Knext >= 2*K {
+		q := float64(Knext) / float64(K)
+		smax := math.Mod(q*thetaMax, 2*math.Pi)
+		smin := math.Mod(q*thetaMin, 2*math.Pi)
+
+		if smax <= math.Pi && smin <= math.Pi {
+			return (Knext - 2) / 4, true
+		}
+
+		if smax >= math.Pi && smin >= math.Pi {
+			return (Knext - 2) / 4, false
+		}
+
+		Knext -= 4
+	}
+
+	return k, up
+}
+
+// Iterative estimates the amplitude without phase estimation, following Grinko, Gacon, Zoufal and Woerner.
+// The returned interval has width at most 2eps with confidence 1 - alpha. Each round measures shots times.
+func Iterative(p Problem, eps, alpha float64, shots int) Result {
+	Q := p.Grover()
+
+	// theta is in [lo, hi], where a = sin^2(theta).
+	lo, hi := 0.0, math.Pi/2
+	k, up := 0, true
+
+	T := math.Ceil(math.Log2(math.Pi / (8 * eps)))
+	queries := 0
+
+	// Counts are accumulated while k does not change.
+	hits, total := 0, 0
+
+	for math.Pow(math.Sin(hi), 2)-math.Pow(math.Sin(lo), 2) > 2*eps {
+		knext, upnext := findNextK(k, lo, hi, up)
+		if knext != k {
+			hits, total = 0, 0
+		}
+		k, up = knext, upnext
+
+		hits += sample(p.goodProb(p.run(Q, k)), shots)
+		total += shots
+		queries += shots * (k + 1)
+
+		// Chernoff-Hoeffding bound.
+		ea := math.Sqrt(math.Log(2*T/alpha) / (2 * float64(total)))
+		ai := float64(hits) / float64(total)
+		amin := math.Max(0, ai-ea)
+		amax := math.Min(1, ai+ea)
+
+		// Measured probability is sin^2((2k+1)theta) = (1 - cos(K theta)) / 2.
+		var smin, smax float64
+		if up {
+			smin = math.Acos(1 - 2*amin)
+			smax = math.Acos(1 - 2*amax)
+		} else {
+			smin = 2*math.Pi - math.Acos(1-2*amax)
+			smax = 2*math.Pi - math.Acos(1-2*amin)
+		}
+
+		K := float64(4*k + 2)
+		newlo := (2*math.Pi*math.Floor(K*lo/(2*math.Pi)) + smin) / K
+		newhi := (2*math.Pi*math.Floor(K*hi/(2*math.Pi)) + smax) / K
+
+		lo = math.Max(lo, newlo)
+		hi = math.Min(hi, newhi)
+	}
+
+	alo := math.Pow(math.Sin(lo), 2)
+	ahi := math.Pow(math.Sin(hi), 2)
+
+	return Result{Estimate: (alo + ahi) / 2, Low: alo, High: ahi, Queries: queries}
+}
@@ -0,0 +1,74 @@
+package amplitude
+
+import (
+	"math"
+)
+
+// ExponentialSchedule returns the schedule 0, 1, 2, 4, ..., 2^(k-2) of k Grover powers.
+func ExponentialSchedule(k int) []int {
+	r := make([]int, k)
+	for i := 1; i < k; i++ {
+		r[i] = 1 << (i - 1)
+	}
+
+	return r
+}
+
+// logLikelihood returns the log likelihood of theta, given good counts hits of shots for each power in schedule.
+func logLikelihood(theta float64, schedule, hits []int, shots int) float64 {
+	r := 0.0
+	for i, k := range schedule {
+		s := math.Sin(float64(2*k+1) * theta)
+		p := math.Max(s*s, 1e-300)
+		q := math.Max(1-s*s, 1e-300)
+		r += float64(hits[i])*math.Log(p) + float64(shots-hits[i])*math.Log(q)
+	}
+
+	return r
+}
+
+// MaximumLikelihood estimates the amplitude without phase estimation, following Suzuki et al.
+// For each power k in schedule, Q^k A|0> is measured shots times,
+// and the amplitude maximizing the likelihood of the outcomes is returned.
+func MaximumLikelihood(p Problem, schedule []int, shots int) float64 {
+	Q := p.Grover()
+
+	hits := make([]int, len(schedule))
+	for i, k := range schedule {
+		hits[i] = sample(p.goodProb(p.run(Q, k)), shots)
+	}
+
+	// Grid search, so that each grid point is finer than the highest frequency.
+	kmax := 0
+	for _, k := range schedule {
+		if k > kmax {
+			kmax = k
+		}
+	}
+	grid := 100 * (2*kmax + 1)
+	step := math.Pi / 2 / float64(grid)
+
+	best, bestl := 0.0, math.Inf(-1)
+	for i := 0; i <= grid; i++ {
+		theta := float64(i) * step
+		if l := logLikelihood(theta, schedule, hits, shots); l > bestl {
+			best, bestl = theta, l
+		}
+	}
+
+	// Refine by golden section search around the best grid point.
+	lo, hi := math.Max(best-step, 0), math.Min(best+step, math.Pi/2)
+	g := (math.Sqrt(5) - 1) / 2
+	for hi-lo > 1e-12 {
+		m1 := hi - g*(hi-lo)
+		m2 := lo + g*(hi-lo)
+		if logLikelihood(m1, schedule, hits, shots) < logLikelihood(m2, schedule, hits, shots) {
+			lo = m1
+		} else {
+			hi = m2
+		}
+	}
+
+	s := math.Sin((lo + hi) / 2)
+	return s * s
+}
@@ -0,0 +1,46 @@
+package bernsteinvazirani
+
+import (
+	"math/bits"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// Returns the oracle f(x) = s . x mod 2.
+func InnerProductFunc(s int) func(int) int {
+	return func(x int) int {
+		return bits.OnesCount(uint(s&x)) % 2
+	}
+}
+
+// Returns the hidden string s of oracle f(x) = s . x mod 2, using a single query.
+func BernsteinVazirani(n int, oracle func(int) int) int {
+	iregs := slice.Range(0, n)
+
+	// Prepare n + 1 registers with |0...01>.
+	q := qsim.NewCircuit(n + 1)
+	q.X(n)
+
+	// Apply H Gate to every register.
+	q.H(iregs...)
+	q.H(n)
+
+	// Apply Oracle! Phase kickback gives (-1)^(s.x)|x>.
+	q.ApplyOracle(oracle, iregs, []int{n})
+
+	// Hadamard, then Measure
+	q.H(iregs...)
+	return q.Measure(iregs...)
+}
+
+// Returns the hidden string s of oracle f(x) = s . x mod 2, using n queries.
+func BernsteinVaziraniClassical(n int, oracle func(int) int) int {
+	// Query each bit of s by f(2^i) = s_i.
+	s := 0
+	for i := 0; i < n; i++ {
+		s |= oracle(1<<i) << i
+	}
+
+	return s
+}
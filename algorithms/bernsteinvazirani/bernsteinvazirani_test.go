@@ -0,0 +1,51 @@
+package bernsteinvazirani_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/sp301415/qsim/algorithms/bernsteinvazirani"
+)
+
+func TestBernsteinVazirani(t *testing.T) {
+	n := 8
+	for i := 0; i < 10; i++ {
+		s := rand.Intn(1 << n)
+		f := bernsteinvazirani.InnerProductFunc(s)
+
+		if bernsteinvazirani.BernsteinVazirani(n, f) != s {
+			t.Fail()
+		}
+
+		if bernsteinvazirani.BernsteinVaziraniClassical(n, f) != s {
+			t.Fail()
+		}
+	}
+}
+
+func BenchmarkBernsteinVazirani8(b *testing.B) {
+	s := 0b10110101
+	for i := 0; i < b.N; i++ {
+		if bernsteinvazirani.BernsteinVazirani(8, bernsteinvazirani.InnerProductFunc(s)) != s {
+			b.Fail()
+		}
+	}
+}
+
+func BenchmarkBernsteinVazirani16(b *testing.B) {
+	s := 0b1011010111001010
+	for i := 0; i < b.N; i++ {
+		if bernsteinvazirani.BernsteinVazirani(16, bernsteinvazirani.InnerProductFunc(s)) != s {
+			b.Fail()
+		}
+	}
+}
+
+func BenchmarkBernsteinVaziraniClassical16(b *testing.B) {
+	s := 0b1011010111001010
+	for i := 0; i < b.N; i++ {
+		if bernsteinvazirani.BernsteinVaziraniClassical(16, bernsteinvazirani.InnerProductFunc(s)) != s {
+			b.Fail()
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Package hhl implements the Harrow-Hassidim-Lloyd algorithm for solving linear systems.
+package hhl
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
+	"github.com/sp301415/qsim/math/number"
+	"github.com/sp301415/qsim/math/vec"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// Result is the result of HHL.
+type Result struct {
+	Solution    vec.Vec // Normalized solution state |x> after post-selection.
+	Classical   vec.Vec // Normalized classical solution of Ax = b.
+	Fidelity    float64 // |<x_classical|x>|^2.
+	SuccessProb float64 // Probability of post-selection, i.e. measuring ancilla as 1.
+}
+
+// StatePrep returns a gate mapping |0> to normalized b.
+// Columns other than the first one are filled by Gram-Schmidt process.
+func StatePrep(b vec.Vec) qsim.Gate {
+	n := b.Dim()
+	cols := []vec.Vec{b.ScalarMul(complex(1/b.Norm(), 0))}
+
+	for k := 0; len(cols) < n; k++ {
+		e := vec.NewVec(n)
+		e[k] = 1
+
+		for _, c := range cols {
+			e = e.Sub(c.ScalarMul(e.Dot(c)))
+		}
+
+		if e.Norm() < 1e-6 {
+			continue
+		}
+		cols = append(cols, e.ScalarMul(complex(1/e.Norm(), 0)))
+	}
+
+	m := mat.NewSquare(n)
+	for j, c := range cols {
+		for i := range c {
+			m[i][j] = c[i]
+		}
+	}
+
+	return qsim.NewGate(m)
+}
+
+// evolution returns exp(iAt) from eigen decomposition of A.
+func evolution(vals []float64, vecs mat.Mat, t float64) mat.Mat {
+	d := mat.NewSquare(len(vals))
+	for i, l := range vals {
+		d[i][i] = cmplx.Rect(1, l*t)
+	}
+
+	return vecs.Mul(d).Mul(vecs.Dagger())
+}
+
+// HHL solves Ax = b for hermitian A of size 2^k, using m clock qubits for phase estimation.
+// exp(iAt) is used as the unitary for phase estimation.
+// If t is zero, it is chosen so that the largest eigenvalue is mapped to the largest positive clock value.
+// Eigenvalues are read as m bit signed integers, so A may have negative eigenvalues.
+func HHL(A mat.Mat, b vec.Vec, m int, t float64) Result {
+	if !A.IsHermitian() {
+		panic("Matrix not hermitian.")
+	}
+
+	N := A.NRows()
+	if N < 2 || N&(N-1) != 0 || b.Dim() != N {
+		panic("Invalid system size.")
+	}
+
+	vals, vecs := A.EigenHermitian()
+
+	lmax := math.Max(math.Abs(vals[0]), math.Abs(vals[N-1]))
+	if t == 0 {
+		t = 2 * math.Pi * float64(number.Pow(2, m-1)-1) / (float64(number.Pow(2, m)) * lmax)
+	}
+
+	nb := number.BitLen(N) - 1
+	bregs := slice.Range(0, nb)
+	cregs := slice.Range(nb, nb+m)
+	anc := nb + m
+
+	c := qsim.NewCircuit(nb + m + 1)
+
+	// Prepare |b>.
+	c.Apply(StatePrep(b), bregs...)
+
+	// Phase estimation on exp(iAt).
+	Us := make([]qsim.Gate, m)
+	U := evolution(vals, vecs, t)
+	for j := range Us {
+		Us[j] = qsim.NewGate(U)
+		U = U.Mul(U)
+	}
+
+	c.H(cregs...)
+	for j := 0; j < m; j++ {
+		c.Control(Us[j], []int{cregs[j]}, bregs)
+	}
+	c.InvQFT(cregs...)
+
+	// Rotate ancilla by C / lambda for each clock value.
+	// Clock value k corresponds to lambda = 2 pi k / (t 2^m), so the smallest one is used for C.
+	C := 2 * math.Pi / (t * float64(number.Pow(2, m)))
+	for k := 1; k < 1<<m; k++ {
+		kk := k
+		if k >= 1<<(m-1) {
+			kk = k - (1 << m)
+		}
+		l := float64(kk) * C
+
+		zeros := make([]int, 0)
+		for i, q := range cregs {
+			if (k>>i)&1 == 0 {
+				zeros = append(zeros, q)
+			}
+		}
+
+		if len(zeros) > 0 {
+			c.X(zeros...)
+		}
+		c.Control(qsim.RY(2*math.Asin(C/l)), cregs, []int{anc})
+		if len(zeros) > 0 {
+			c.X(zeros...)
+		}
+	}
+
+	// Uncompute phase estimation.
+	c.QFT(cregs...)
+	for j := m - 1; j >= 0; j-- {
+		c.Control(qsim.NewGate(Us[j].ToMat().Dagger()), []int{cregs[j]}, bregs)
+	}
+	c.H(cregs...)
+
+	// Post-select ancilla = 1. Clock is restored to zero.
+	q := c.State()
+	x := vec.NewVec(N)
+	for i := range x {
+		x[i] = q.At(i | 1<<anc)
+	}
+
+	p := x.NormSquared()
+	x = x.ScalarMul(complex(1/math.Sqrt(p), 0))
+
+	// Classical solution is sum of <v_k|b>/lambda_k |v_k>.
+	xc := vec.NewVec(N)
+	for k, l := range vals {
+		v := vecs.GetCol(k)
+		xc = xc.Add(v.ScalarMul(b.Dot(v) / complex(l, 0)))
+	}
+	xc = xc.ScalarMul(complex(1/xc.Norm(), 0))
+
+	f := cmplx.Abs(x.Dot(xc))
+
+	return Result{Solution: x, Classical: xc, Fidelity: f * f, SuccessProb: p}
+}
@@ -0,0 +1,57 @@
+package hhl_test
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+
+	"github.com/sp301415/qsim/algorithms/hhl"
+	"github.com/sp301415/qsim/math/mat"
+	"github.com/sp301415/qsim/math/vec"
+)
+
+func TestHHL2(t *testing.T) {
+	A := mat.NewMatVars(2, 1, -1.0/3, -1.0/3, 1)
+	b := vec.NewVecVars(1, 0)
+
+	// Eigenvalues 2/3 and 4/3 are mapped to clock values 8 and 16 exactly.
+	m := 6
+	tt := 2 * math.Pi * 8 / (64 * 2.0 / 3)
+	r := hhl.HHL(A, b, m, tt)
+
+	if math.Abs(r.Fidelity-1) > 1e-6 {
+		t.Fatal(r.Fidelity)
+	}
+
+	// Solution is (3, 1) / sqrt(10), up to global phase.
+	if math.Abs(cmplx.Abs(r.Solution[0])-3/math.Sqrt(10)) > 1e-6 || math.Abs(cmplx.Abs(r.Solution[1])-1/math.Sqrt(10)) > 1e-6 {
+		t.Fatal(r.Solution)
+	}
+}
+
+func TestHHL16(t *testing.T) {
+	N := 16
+
+	// Random hermitian matrix with eigenvalues away from zero.
+	A := mat.NewSquare(N)
+	for i := 0; i < N; i++ {
+		A[i][i] = complex(2+rand.Float64(), 0)
+		for j := i + 1; j < N; j++ {
+			a := complex(rand.Float64()-0.5, rand.Float64()-0.5) * 0.3
+			A[i][j] = a
+			A[j][i] = complex(real(a), -imag(a))
+		}
+	}
+
+	b := vec.NewVec(N)
+	for i := range b {
+		b[i] = complex(rand.Float64(), rand.Float64())
+	}
+
+	r := hhl.HHL(A, b, 7, 0)
+
+	if r.Fidelity < 0.95 {
+		t.Fatal(r.Fidelity)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/sp301415/qsim"
 	"github.com/sp301415/qsim/algorithms/shor/fraction"
 	"github.com/sp301415/qsim/math/number"
-	"github.com/sp301415/qsim/utils/slice"
 )
 
 func shorInstance(N int, verbose bool) int {
@@ -38,12 +37,12 @@ func shorInstance(N int, verbose bool) int {
 	}
 
 	// Quantum Part.
-	q := qsim.NewCircuit(3 * n)
-	q.SetBit((1 << n) - 1)
-
-	iregs := slice.Range(n, 3*n)
-	oregs := slice.Range(0, n)
+	q := qsim.NewCircuit(0)
+	oregs := q.AddRegister("out", n)
+	iregs := q.AddRegister("in", 2*n)
+	res := q.AddClassicalRegister("res", 2*n)
 
+	q.X(oregs...)
 	q.H(iregs...)
 
 	if verbose {
@@ -63,7 +62,7 @@ func shorInstance(N int, verbose bool) int {
 		fmt.Println("[*] Measuring...")
 	}
 
-	y := q.Measure(iregs...)
+	y := q.MeasureTo(res, iregs...)
 
 	if verbose {
 		fmt.Printf("[+] Measured output: %d\n", y)
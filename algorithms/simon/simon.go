@@ -0,0 +1,57 @@
+package simon
+
+import (
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/number"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// Returns a two-to-one oracle f with f(x) = f(x ^ s), or a one-to-one oracle if s = 0.
+func MaskFunc(s int) func(int) int {
+	return func(x int) int {
+		return number.Min(x, x^s)
+	}
+}
+
+// Returns the hidden mask s of oracle f, where f(x) = f(y) if and only if y = x or y = x ^ s.
+func Simon(n int, oracle func(int) int) int {
+	iregs := slice.Range(0, n)
+	oregs := slice.Range(n, 2*n)
+
+	eqs := newSystem(n)
+
+	// Each run gives a random y with y . s = 0. Collect n - 1 independent equations.
+	for eqs.Rank() < n-1 {
+		q := qsim.NewCircuit(2 * n)
+
+		q.H(iregs...)
+		q.ApplyOracle(oracle, iregs, oregs)
+		q.H(iregs...)
+
+		eqs.Add(q.Measure(iregs...))
+	}
+
+	// The only nonzero solution is the candidate. If it fails, f is one-to-one.
+	s := eqs.Solve()
+	if oracle(0) != oracle(s) {
+		return 0
+	}
+
+	return s
+}
+
+// Returns the hidden mask s of oracle f, by searching for a collision.
+func SimonClassical(n int, oracle func(int) int) int {
+	// Evaluate up to 2^(n-1) + 1 times
+	seen := make(map[int]int)
+
+	for x := 0; x < (1<<(n-1))+1; x++ {
+		y := oracle(x)
+		if x0, ok := seen[y]; ok {
+			return x0 ^ x
+		}
+		seen[y] = x
+	}
+
+	return 0
+}
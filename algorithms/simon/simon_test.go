@@ -0,0 +1,51 @@
+package simon_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/sp301415/qsim/algorithms/simon"
+)
+
+func TestSimon(t *testing.T) {
+	n := 6
+	for i := 0; i < 10; i++ {
+		s := rand.Intn(1 << n)
+		f := simon.MaskFunc(s)
+
+		if simon.Simon(n, f) != s {
+			t.Fail()
+		}
+
+		if simon.SimonClassical(n, f) != s {
+			t.Fail()
+		}
+	}
+}
+
+func BenchmarkSimon6(b *testing.B) {
+	s := 0b101101
+	for i := 0; i < b.N; i++ {
+		if simon.Simon(6, simon.MaskFunc(s)) != s {
+			b.Fail()
+		}
+	}
+}
+
+func BenchmarkSimon8(b *testing.B) {
+	s := 0b10110101
+	for i := 0; i < b.N; i++ {
+		if simon.Simon(8, simon.MaskFunc(s)) != s {
+			b.Fail()
+		}
+	}
+}
+
+func BenchmarkSimonClassical10(b *testing.B) {
+	s := 0b1011010111
+	for i := 0; i < b.N; i++ {
+		if simon.SimonClassical(10, simon.MaskFunc(s)) != s {
+			b.Fail()
+		}
+	}
+}
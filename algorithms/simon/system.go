@@ -0,0 +1,66 @@
+package simon
+
+import (
+	"math/bits"
+)
+
+// system is a homogeneous linear system over GF(2), in reduced row echelon form.
+// Each equation y represents y . s = 0.
+type system struct {
+	n    int
+	rows map[int]int // pivot -> row
+}
+
+// newSystem allocates an empty system of n variables.
+func newSystem(n int) *system {
+	return &system{n: n, rows: make(map[int]int)}
+}
+
+// Rank returns the number of independent equations.
+func (e *system) Rank() int {
+	return len(e.rows)
+}
+
+// Add adds an equation y . s = 0, if it is independent from others.
+func (e *system) Add(y int) {
+	for p, r := range e.rows {
+		if (y>>p)&1 == 1 {
+			y ^= r
+		}
+	}
+
+	if y == 0 {
+		return
+	}
+
+	// Use the highest bit as pivot, and eliminate it from other rows.
+	p := bits.Len(uint(y)) - 1
+	for q, r := range e.rows {
+		if (r>>p)&1 == 1 {
+			e.rows[q] = r ^ y
+		}
+	}
+	e.rows[p] = y
+}
+
+// Solve returns a nonzero solution of the system. Rank should be n - 1.
+func (e *system) Solve() int {
+	if e.Rank() != e.n-1 {
+		panic("System should have exactly one free variable.")
+	}
+
+	free := 0
+	for ; free < e.n; free++ {
+		if _, ok := e.rows[free]; !ok {
+			break
+		}
+	}
+
+	// Set free variable to 1. Then each pivot variable equals the coefficient of free variable.
+	s := 1 << free
+	for p, r := range e.rows {
+		s |= ((r >> free) & 1) << p
+	}
+
+	return s
+}
@@ -0,0 +1,288 @@
+// Package arith implements reversible arithmetic circuits on qubit registers.
+// Every register is a slice of qubit indices in little endian order,
+// so reg[0] is the least significant bit.
+package arith
+
+import (
+	"math"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// Helper functions.
+
+// ctrlApply applies one qubit gate to i, controlled by ctrls.
+// If ctrls is empty, the gate is applied directly.
+func ctrlApply(c *qsim.Circuit, op qsim.Gate, ctrls []int, i int) {
+	if len(ctrls) == 0 {
+		c.Apply(op, i)
+		return
+	}
+
+	c.Control(op, ctrls, []int{i})
+}
+
+// with returns a new slice of ctrls followed by is.
+func with(ctrls []int, is ...int) []int {
+	return append(append(make([]int, 0, len(ctrls)+len(is)), ctrls...), is...)
+}
+
+// checkRegs panics if registers overlap.
+func checkRegs(regs ...[]int) {
+	all := make([]int, 0)
+	for _, r := range regs {
+		all = append(all, r...)
+	}
+
+	if slice.HasDuplicate(all) {
+		panic("Duplicate registers.")
+	}
+}
+
+// Ripple carry adders.
+
+// maj is the MAJ block of Cuccaro adder. Computes the majority of (x, y, z) into z.
+func maj(c *qsim.Circuit, x, y, z int) {
+	c.CX(z, y)
+	c.CX(z, x)
+	c.CCX(x, y, z)
+}
+
+// invMaj is the inverse of maj.
+func invMaj(c *qsim.Circuit, x, y, z int) {
+	c.CCX(x, y, z)
+	c.CX(z, x)
+	c.CX(z, y)
+}
+
+// uma is the UMA block of Cuccaro adder. Uncomputes maj and writes the sum into y.
+func uma(c *qsim.Circuit, x, y, z int) {
+	c.CCX(x, y, z)
+	c.CX(z, x)
+	c.CX(x, y)
+}
+
+// CuccaroAdd maps |a>|b> -> |a>|b+a mod 2^len(b)> using Cuccaro ripple carry adder.
+// b should have len(a) or len(a)+1 qubits. In the latter case, the last qubit of b receives the carry.
+// anc is one ancilla qubit in |0>, which is restored.
+func CuccaroAdd(c *qsim.Circuit, a, b []int, anc int) {
+	n := len(a)
+	if n == 0 || (len(b) != n && len(b) != n+1) {
+		panic("Invalid register size.")
+	}
+	checkRegs(a, b, []int{anc})
+
+	maj(c, anc, b[0], a[0])
+	for i := 1; i < n; i++ {
+		maj(c, a[i-1], b[i], a[i])
+	}
+
+	if len(b) == n+1 {
+		c.CX(a[n-1], b[n])
+	}
+
+	for i := n - 1; i > 0; i-- {
+		uma(c, a[i-1], b[i], a[i])
+	}
+	uma(c, anc, b[0], a[0])
+}
+
+// CuccaroSub maps |a>|b> -> |a>|b-a mod 2^len(b)> using Cuccaro ripple carry adder.
+// Register sizes are same as CuccaroAdd.
+func CuccaroSub(c *qsim.Circuit, a, b []int, anc int) {
+	// b - a = ~(~b + a).
+	c.X(b...)
+	CuccaroAdd(c, a, b, anc)
+	c.X(b...)
+}
+
+// LessThan flips out if a < b, where a and b are registers of same size.
+// anc is one ancilla qubit in |0>. Every register is restored.
+func LessThan(c *qsim.Circuit, a, b []int, anc, out int) {
+	n := len(a)
+	if n == 0 || len(b) != n {
+		panic("Invalid register size.")
+	}
+	checkRegs(a, b, []int{anc, out})
+
+	// ~a + b >= 2^n if and only if a < b.
+	c.X(a...)
+
+	maj(c, anc, a[0], b[0])
+	for i := 1; i < n; i++ {
+		maj(c, b[i-1], a[i], b[i])
+	}
+
+	c.CX(b[n-1], out)
+
+	for i := n - 1; i > 0; i-- {
+		invMaj(c, b[i-1], a[i], b[i])
+	}
+	invMaj(c, anc, a[0], b[0])
+
+	c.X(a...)
+}
+
+// carry is the CARRY block of VBE adder.
+func carry(c *qsim.Circuit, ci, a, b, co int) {
+	c.CCX(a, b, co)
+	c.CX(a, b)
+	c.CCX(ci, b, co)
+}
+
+// invCarry is the inverse of carry.
+func invCarry(c *qsim.Circuit, ci, a, b, co int) {
+	c.CCX(ci, b, co)
+	c.CX(a, b)
+	c.CCX(a, b, co)
+}
+
+// sum is the SUM block of VBE adder.
+func sum(c *qsim.Circuit, ci, a, b int) {
+	c.CX(a, b)
+	c.CX(ci, b)
+}
+
+// VBEAdd maps |a>|b> -> |a>|b+a mod 2^len(b)> using Vedral-Barenco-Ekert ripple carry adder.
+// b should have len(a) or len(a)+1 qubits. In the latter case, the last qubit of b receives the carry.
+// carries are len(a) ancilla qubits in |0>, which are restored.
+func VBEAdd(c *qsim.Circuit, a, b, carries []int) {
+	n := len(a)
+	if n == 0 || (len(b) != n && len(b) != n+1) || len(carries) != n {
+		panic("Invalid register size.")
+	}
+	checkRegs(a, b, carries)
+
+	for i := 0; i < n-1; i++ {
+		carry(c, carries[i], a[i], b[i], carries[i+1])
+	}
+
+	if len(b) == n+1 {
+		carry(c, carries[n-1], a[n-1], b[n-1], b[n])
+		c.CX(a[n-1], b[n-1])
+	}
+	sum(c, carries[n-1], a[n-1], b[n-1])
+
+	for i := n - 2; i >= 0; i-- {
+		invCarry(c, carries[i], a[i], b[i], carries[i+1])
+		sum(c, carries[i], a[i], b[i])
+	}
+}
+
+// VBESub maps |a>|b> -> |a>|b-a mod 2^len(b)> using Vedral-Barenco-Ekert ripple carry adder.
+// Register sizes are same as VBEAdd.
+func VBESub(c *qsim.Circuit, a, b, carries []int) {
+	c.X(b...)
+	VBEAdd(c, a, b, carries)
+	c.X(b...)
+}
+
+// QFT adders.
+
+// phase returns the angle of 2^k / 2^m turn.
+func phase(k, m int) float64 {
+	return 2 * math.Pi * math.Ldexp(1, k-m)
+}
+
+// PhiAdd adds a to b, where b is in the Fourier basis (i.e. after QFT).
+// This maps |a>|phi(b)> -> |a>|phi(b+a mod 2^len(b))>. Gates are controlled by ctrls, which may be empty.
+func PhiAdd(c *qsim.Circuit, a, b []int, ctrls ...int) {
+	m := len(b)
+	for j := range b {
+		for i := range a {
+			if i+j >= m {
+				break
+			}
+			c.Control(qsim.P(phase(i+j, m)), with(ctrls, a[i]), []int{b[j]})
+		}
+	}
+}
+
+// InvPhiAdd is the inverse of PhiAdd.
+func InvPhiAdd(c *qsim.Circuit, a, b []int, ctrls ...int) {
+	m := len(b)
+	for j := range b {
+		for i := range a {
+			if i+j >= m {
+				break
+			}
+			c.Control(qsim.P(-phase(i+j, m)), with(ctrls, a[i]), []int{b[j]})
+		}
+	}
+}
+
+// PhiAddConst adds constant k to b, where b is in the Fourier basis (i.e. after QFT).
+// This maps |phi(b)> -> |phi(b+k mod 2^len(b))>. k may be negative. Gates are controlled by ctrls, which may be empty.
+func PhiAddConst(c *qsim.Circuit, k int, b []int, ctrls ...int) {
+	m := len(b)
+	k = ((k % (1 << m)) + (1 << m)) % (1 << m)
+
+	for j := range b {
+		// Only lower m-j bits of k contribute to b[j].
+		t := k & ((1 << (m - j)) - 1)
+		if t == 0 {
+			continue
+		}
+		ctrlApply(c, qsim.P(phase(j, m)*float64(t)), ctrls, b[j])
+	}
+}
+
+// DraperAdd maps |a>|b> -> |a>|b+a mod 2^len(b)> using Draper QFT adder.
+// a should not be longer than b. No ancillas are required.
+func DraperAdd(c *qsim.Circuit, a, b []int) {
+	if len(a) == 0 || len(a) > len(b) {
+		panic("Invalid register size.")
+	}
+	checkRegs(a, b)
+
+	c.QFT(b...)
+	PhiAdd(c, a, b)
+	c.InvQFT(b...)
+}
+
+// DraperSub maps |a>|b> -> |a>|b-a mod 2^len(b)> using Draper QFT adder.
+func DraperSub(c *qsim.Circuit, a, b []int) {
+	if len(a) == 0 || len(a) > len(b) {
+		panic("Invalid register size.")
+	}
+	checkRegs(a, b)
+
+	c.QFT(b...)
+	InvPhiAdd(c, a, b)
+	c.InvQFT(b...)
+}
+
+// AddConst maps |b> -> |b+k mod 2^len(b)>. k may be negative.
+// Gates are controlled by ctrls, which may be empty.
+func AddConst(c *qsim.Circuit, k int, b []int, ctrls ...int) {
+	if len(b) == 0 {
+		panic("Invalid register size.")
+	}
+	checkRegs(b, ctrls)
+
+	c.QFT(b...)
+	PhiAddConst(c, k, b, ctrls...)
+	c.InvQFT(b...)
+}
+
+// SubConst maps |b> -> |b-k mod 2^len(b)>.
+// Gates are controlled by ctrls, which may be empty.
+func SubConst(c *qsim.Circuit, k int, b []int, ctrls ...int) {
+	AddConst(c, -k, b, ctrls...)
+}
+
+// MulConst maps |x>|b> -> |x>|b+k*x mod 2^len(b)>.
+// Gates are controlled by ctrls, which may be empty.
+func MulConst(c *qsim.Circuit, k int, x, b []int, ctrls ...int) {
+	if len(x) == 0 || len(b) == 0 {
+		panic("Invalid register size.")
+	}
+	checkRegs(x, b, ctrls)
+
+	c.QFT(b...)
+	for i := range x {
+		PhiAddConst(c, k<<i, b, with(ctrls, x[i])...)
+	}
+	c.InvQFT(b...)
+}
@@ -0,0 +1,326 @@
+package arith_test
+
+import (
+	"math/cmplx"
+	"testing"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/arith"
+	"github.com/sp301415/qsim/math/number"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// encode returns the basis where each register holds given value.
+func encode(regs [][]int, vals []int) int {
+	n := 0
+	for i, r := range regs {
+		for j, q := range r {
+			n |= ((vals[i] >> j) & 1) << q
+		}
+	}
+	return n
+}
+
+// decode returns the value of register from basis.
+func decode(n int, reg []int) int {
+	v := 0
+	for j, q := range reg {
+		v |= ((n >> q) & 1) << j
+	}
+	return v
+}
+
+// basis returns the basis state of c. Fails if c is not in a basis state.
+func basis(t *testing.T, c *qsim.Circuit) int {
+	q := c.State()
+	for n := 0; n < q.Dim(); n++ {
+		if cmplx.Abs(q.At(n)) > 1-1e-6 {
+			return n
+		}
+	}
+	t.Fatal("Not a basis state.")
+	return 0
+}
+
+func TestCuccaroAdd(t *testing.T) {
+	n := 3
+	a := slice.Range(0, n)
+	b := slice.Range(n, 2*n+1)
+	anc := 2*n + 1
+
+	for x := 0; x < 1<<n; x++ {
+		for y := 0; y < 1<<(n+1); y++ {
+			c := qsim.NewCircuit(2*n + 2)
+			c.SetBit(encode([][]int{a, b}, []int{x, y}))
+			arith.CuccaroAdd(c, a, b, anc)
+
+			r := basis(t, c)
+			if decode(r, a) != x || decode(r, b) != (x+y)%(1<<(n+1)) || (r>>anc)&1 != 0 {
+				t.Fatalf("%d + %d", x, y)
+			}
+
+			arith.CuccaroSub(c, a, b, anc)
+			if basis(t, c) != encode([][]int{a, b}, []int{x, y}) {
+				t.Fatalf("%d + %d - %d", x, y, x)
+			}
+		}
+	}
+}
+
+func TestCuccaroAddNoCarry(t *testing.T) {
+	n := 3
+	a := slice.Range(0, n)
+	b := slice.Range(n, 2*n)
+	anc := 2 * n
+
+	for x := 0; x < 1<<n; x++ {
+		for y := 0; y < 1<<n; y++ {
+			c := qsim.NewCircuit(2*n + 1)
+			c.SetBit(encode([][]int{a, b}, []int{x, y}))
+			arith.CuccaroAdd(c, a, b, anc)
+
+			r := basis(t, c)
+			if decode(r, a) != x || decode(r, b) != (x+y)%(1<<n) || (r>>anc)&1 != 0 {
+				t.Fatalf("%d + %d", x, y)
+			}
+		}
+	}
+}
+
+func TestVBEAdd(t *testing.T) {
+	n := 3
+	a := slice.Range(0, n)
+	carries := slice.Range(n, 2*n)
+
+	for _, m := range []int{n, n + 1} {
+		b := slice.Range(2*n, 2*n+m)
+
+		for x := 0; x < 1<<n; x++ {
+			for y := 0; y < 1<<m; y++ {
+				c := qsim.NewCircuit(2*n + m)
+				c.SetBit(encode([][]int{a, b}, []int{x, y}))
+				arith.VBEAdd(c, a, b, carries)
+
+				r := basis(t, c)
+				if r != encode([][]int{a, b}, []int{x, (x + y) % (1 << m)}) {
+					t.Fatalf("%d + %d", x, y)
+				}
+
+				arith.VBESub(c, a, b, carries)
+				if basis(t, c) != encode([][]int{a, b}, []int{x, y}) {
+					t.Fatalf("%d + %d - %d", x, y, x)
+				}
+			}
+		}
+	}
+}
+
+func TestLessThan(t *testing.T) {
+	n := 3
+	a := slice.Range(0, n)
+	b := slice.Range(n, 2*n)
+	anc, out := 2*n, 2*n+1
+
+	for x := 0; x < 1<<n; x++ {
+		for y := 0; y < 1<<n; y++ {
+			c := qsim.NewCircuit(2*n + 2)
+			c.SetBit(encode([][]int{a, b}, []int{x, y}))
+			arith.LessThan(c, a, b, anc, out)
+
+			lt := 0
+			if x < y {
+				lt = 1
+			}
+
+			if basis(t, c) != encode([][]int{a, b, {out}}, []int{x, y, lt}) {
+				t.Fatalf("%d < %d", x, y)
+			}
+		}
+	}
+}
+
+func TestDraperAdd(t *testing.T) {
+	n := 3
+	a := slice.Range(0, n)
+	b := slice.Range(n, 2*n+1)
+
+	for x := 0; x < 1<<n; x++ {
+		for y := 0; y < 1<<(n+1); y++ {
+			c := qsim.NewCircuit(2*n + 1)
+			c.SetBit(encode([][]int{a, b}, []int{x, y}))
+			arith.DraperAdd(c, a, b)
+
+			if basis(t, c) != encode([][]int{a, b}, []int{x, (x + y) % (1 << (n + 1))}) {
+				t.Fatalf("%d + %d", x, y)
+			}
+
+			arith.DraperSub(c, a, b)
+			if basis(t, c) != encode([][]int{a, b}, []int{x, y}) {
+				t.Fatalf("%d + %d - %d", x, y, x)
+			}
+		}
+	}
+}
+
+func TestAddConst(t *testing.T) {
+	n := 4
+	b := slice.Range(0, n)
+	ctrl := n
+
+	for k := -3; k < 1<<n; k++ {
+		for y := 0; y < 1<<n; y++ {
+			for on := 0; on < 2; on++ {
+				c := qsim.NewCircuit(n + 1)
+				c.SetBit(encode([][]int{b, {ctrl}}, []int{y, on}))
+				arith.AddConst(c, k, b, ctrl)
+
+				z := y
+				if on == 1 {
+					z = ((y+k)%(1<<n) + (1 << n)) % (1 << n)
+				}
+
+				if basis(t, c) != encode([][]int{b, {ctrl}}, []int{z, on}) {
+					t.Fatalf("%d + %d", y, k)
+				}
+			}
+		}
+	}
+}
+
+func TestMulConst(t *testing.T) {
+	n := 3
+	x := slice.Range(0, n)
+	b := slice.Range(n, 2*n+1)
+
+	for k := 0; k < 5; k++ {
+		for v := 0; v < 1<<n; v++ {
+			c := qsim.NewCircuit(2*n + 1)
+			c.SetBit(encode([][]int{x, b}, []int{v, 3}))
+			arith.MulConst(c, k, x, b)
+
+			if basis(t, c) != encode([][]int{x, b}, []int{v, (3 + k*v) % (1 << (n + 1))}) {
+				t.Fatalf("%d * %d", k, v)
+			}
+		}
+	}
+}
+
+func TestModAddConst(t *testing.T) {
+	N := 5
+	b := slice.Range(0, 4)
+	anc := 4
+	ctrl := 5
+
+	for k := 0; k < N; k++ {
+		for y := 0; y < N; y++ {
+			for on := 0; on < 2; on++ {
+				c := qsim.NewCircuit(6)
+				c.SetBit(encode([][]int{b, {ctrl}}, []int{y, on}))
+				arith.ModAddConst(c, k, N, b, anc, ctrl)
+
+				z := y
+				if on == 1 {
+					z = (y + k) % N
+				}
+
+				if basis(t, c) != encode([][]int{b, {ctrl}}, []int{z, on}) {
+					t.Fatalf("%d + %d mod %d", y, k, N)
+				}
+
+				arith.ModSubConst(c, k, N, b, anc, ctrl)
+				if basis(t, c) != encode([][]int{b, {ctrl}}, []int{y, on}) {
+					t.Fatalf("%d + %d - %d mod %d", y, k, k, N)
+				}
+			}
+		}
+	}
+}
+
+func TestModAdd(t *testing.T) {
+	N := 7
+	a := slice.Range(0, 3)
+	b := slice.Range(3, 7)
+	anc := 7
+
+	for x := 0; x < N; x++ {
+		for y := 0; y < N; y++ {
+			c := qsim.NewCircuit(8)
+			c.SetBit(encode([][]int{a, b}, []int{x, y}))
+			arith.ModAdd(c, N, a, b, anc)
+
+			if basis(t, c) != encode([][]int{a, b}, []int{x, (x + y) % N}) {
+				t.Fatalf("%d + %d mod %d", x, y, N)
+			}
+
+			arith.ModSub(c, N, a, b, anc)
+			if basis(t, c) != encode([][]int{a, b}, []int{x, y}) {
+				t.Fatalf("%d + %d - %d mod %d", x, y, x, N)
+			}
+		}
+	}
+}
+
+func TestModMulConst(t *testing.T) {
+	N := 7
+	x := slice.Range(0, 3)
+	b := slice.Range(3, 7)
+	anc := 7
+
+	for k := 0; k < N; k++ {
+		for v := 0; v < 1<<3; v++ {
+			c := qsim.NewCircuit(8)
+			c.SetBit(encode([][]int{x, b}, []int{v, 2}))
+			arith.ModMulConst(c, k, N, x, b, anc)
+
+			if basis(t, c) != encode([][]int{x, b}, []int{v, (2 + k*v) % N}) {
+				t.Fatalf("2 + %d * %d mod %d", k, v, N)
+			}
+		}
+	}
+}
+
+func TestModMulConstInPlace(t *testing.T) {
+	N := 5
+	x := slice.Range(0, 3)
+	b := slice.Range(3, 7)
+	anc := 7
+	ctrl := 8
+
+	for k := 1; k < N; k++ {
+		for v := 0; v < N; v++ {
+			for on := 0; on < 2; on++ {
+				c := qsim.NewCircuit(9)
+				c.SetBit(encode([][]int{x, {ctrl}}, []int{v, on}))
+				arith.ModMulConstInPlace(c, k, N, x, b, anc, ctrl)
+
+				z := v
+				if on == 1 {
+					z = (k * v) % N
+				}
+
+				if basis(t, c) != encode([][]int{x, {ctrl}}, []int{z, on}) {
+					t.Fatalf("%d * %d mod %d", k, v, N)
+				}
+			}
+		}
+	}
+}
+
+func TestModExp(t *testing.T) {
+	N := 15
+	a := 7
+	x := slice.Range(0, 3)
+	y := slice.Range(3, 7)
+	b := slice.Range(7, 12)
+	anc := 12
+
+	for v := 0; v < 1<<len(x); v++ {
+		c := qsim.NewCircuit(13)
+		c.SetBit(encode([][]int{x, y}, []int{v, 1}))
+		arith.ModExp(c, a, N, x, y, b, anc)
+
+		if basis(t, c) != encode([][]int{x, y}, []int{v, number.PowMod(a, v, N)}) {
+			t.Fatalf("%d ^ %d mod %d", a, v, N)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package arith
+
+import (
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/number"
+)
+
+// Modular arithmetic, following Beauregard's construction.
+// Every modular function requires a register b with N < 2^(len(b)-1),
+// since the most significant bit of b is used to detect overflows.
+// Inputs should be smaller than N.
+
+// checkMod panics if b cannot hold numbers modulo N.
+func checkMod(N int, b []int) {
+	if N <= 0 || len(b) < 2 || N >= 1<<(len(b)-1) {
+		panic("Register too small for modulus.")
+	}
+}
+
+// phiModAdd is the generic modular adder in the Fourier basis.
+// add and sub adds and subtracts the summand from b respectively, both in the Fourier basis.
+func phiModAdd(c *qsim.Circuit, add, sub func(), N int, b []int, anc int) {
+	msb := b[len(b)-1]
+
+	add()
+	PhiAddConst(c, -N, b)
+
+	// Check if b + a - N is negative, and add N back.
+	c.InvQFT(b...)
+	c.CX(msb, anc)
+	c.QFT(b...)
+	PhiAddConst(c, N, b, anc)
+
+	// Uncompute anc. b + a - a is negative if and only if overflow occurred.
+	sub()
+	c.InvQFT(b...)
+	c.X(msb)
+	c.CX(msb, anc)
+	c.X(msb)
+	c.QFT(b...)
+	add()
+}
+
+// invPhiModAdd is the inverse of phiModAdd.
+func invPhiModAdd(c *qsim.Circuit, add, sub func(), N int, b []int, anc int) {
+	msb := b[len(b)-1]
+
+	sub()
+	c.InvQFT(b...)
+	c.X(msb)
+	c.CX(msb, anc)
+	c.X(msb)
+	c.QFT(b...)
+	add()
+
+	PhiAddConst(c, -N, b, anc)
+	c.InvQFT(b...)
+	c.CX(msb, anc)
+	c.QFT(b...)
+
+	PhiAddConst(c, N, b)
+	sub()
+}
+
+// PhiModAddConst adds constant k to b modulo N, where b is in the Fourier basis.
+// This maps |phi(b)> -> |phi(b+k mod N)>. anc is one ancilla qubit in |0>, which is restored.
+// Gates are controlled by ctrls, which may be empty.
+func PhiModAddConst(c *qsim.Circuit, k, N int, b []int, anc int, ctrls ...int) {
+	checkMod(N, b)
+	k = ((k % N) + N) % N
+
+	phiModAdd(c,
+		func() { PhiAddConst(c, k, b, ctrls...) },
+		func() { PhiAddConst(c, -k, b, ctrls...) },
+		N, b, anc,
+	)
+}
+
+// ModAddConst maps |b> -> |b+k mod N>. anc is one ancilla qubit in |0>, which is restored.
+// Gates are controlled by ctrls, which may be empty.
+func ModAddConst(c *qsim.Circuit, k, N int, b []int, anc int, ctrls ...int) {
+	checkMod(N, b)
+	checkRegs(b, []int{anc}, ctrls)
+
+	c.QFT(b...)
+	PhiModAddConst(c, k, N, b, anc, ctrls...)
+	c.InvQFT(b...)
+}
+
+// ModSubConst maps |b> -> |b-k mod N>. anc is one ancilla qubit in |0>, which is restored.
+// Gates are controlled by ctrls, which may be empty.
+func ModSubConst(c *qsim.Circuit, k, N int, b []int, anc int, ctrls ...int) {
+	ModAddConst(c, -k, N, b, anc, ctrls...)
+}
+
+// ModAdd maps |a>|b> -> |a>|b+a mod N>. anc is one ancilla qubit in |0>, which is restored.
+func ModAdd(c *qsim.Circuit, N int, a, b []int, anc int) {
+	checkMod(N, b)
+	if len(a) == 0 || len(a) >= len(b) {
+		panic("Invalid register size.")
+	}
+	checkRegs(a, b, []int{anc})
+
+	c.QFT(b...)
+	phiModAdd(c,
+		func() { PhiAdd(c, a, b) },
+		func() { InvPhiAdd(c, a, b) },
+		N, b, anc,
+	)
+	c.InvQFT(b...)
+}
+
+// ModSub maps |a>|b> -> |a>|b-a mod N>. anc is one ancilla qubit in |0>, which is restored.
+func ModSub(c *qsim.Circuit, N int, a, b []int, anc int) {
+	checkMod(N, b)
+	if len(a) == 0 || len(a) >= len(b) {
+		panic("Invalid register size.")
+	}
+	checkRegs(a, b, []int{anc})
+
+	c.QFT(b...)
+	invPhiModAdd(c,
+		func() { PhiAdd(c, a, b) },
+		func() { InvPhiAdd(c, a, b) },
+		N, b, anc,
+	)
+	c.InvQFT(b...)
+}
+
+// ModMulConst maps |x>|b> -> |x>|b+k*x mod N>. anc is one ancilla qubit in |0>, which is restored.
+// Gates are controlled by ctrls, which may be empty.
+func ModMulConst(c *qsim.Circuit, k, N int, x, b []int, anc int, ctrls ...int) {
+	checkMod(N, b)
+	if len(x) == 0 {
+		panic("Invalid register size.")
+	}
+	checkRegs(x, b, []int{anc}, ctrls)
+
+	c.QFT(b...)
+	t := ((k % N) + N) % N
+	for i := range x {
+		PhiModAddConst(c, t, N, b, anc, with(ctrls, x[i])...)
+		t = (2 * t) % N
+	}
+	c.InvQFT(b...)
+}
+
+// cswap swaps two qubits, controlled by ctrls.
+func cswap(c *qsim.Circuit, ctrls []int, i0, i1 int) {
+	if len(ctrls) == 0 {
+		c.Swap(i0, i1)
+		return
+	}
+
+	c.CX(i1, i0)
+	c.Control(qsim.X(), with(ctrls, i0), []int{i1})
+	c.CX(i1, i0)
+}
+
+// ModMulConstInPlace maps |x> -> |k*x mod N>. k should be invertible modulo N.
+// b is an ancilla register of len(x)+1 qubits, and anc is one ancilla qubit. Both should be zero, and are restored.
+// Gates are controlled by ctrls, which may be empty.
+func ModMulConstInPlace(c *qsim.Circuit, k, N int, x, b []int, anc int, ctrls ...int) {
+	if len(b) != len(x)+1 {
+		panic("Invalid register size.")
+	}
+	kinv := number.ModInverse(k, N)
+
+	ModMulConst(c, k, N, x, b, anc, ctrls...)
+	for i := range x {
+		cswap(c, ctrls, x[i], b[i])
+	}
+	ModMulConst(c, -kinv, N, x, b, anc, ctrls...)
+}
+
+// ModExp maps |x>|y> -> |x>|y*a^x mod N>. a should be invertible modulo N.
+// b is an ancilla register of len(y)+1 qubits, and anc is one ancilla qubit. Both should be zero, and are restored.
+func ModExp(c *qsim.Circuit, a, N int, x, y, b []int, anc int) {
+	checkRegs(x, y, b, []int{anc})
+
+	t := ((a % N) + N) % N
+	for i := range x {
+		ModMulConstInPlace(c, t, N, y, b, anc, x[i])
+		t = (t * t) % N
+	}
+}
@@ -1,68 +1,111 @@
 package qsim
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 	"runtime"
-	"sync"
 
 	"github.com/sp301415/qsim/math/number"
-	"github.com/sp301415/qsim/math/vec"
 	"github.com/sp301415/qsim/utils/slice"
 )
 
 // Options for a circuit.
 type Options struct {
-	GOROUTINE_CNT      int // Number of goroutines to execute. Defaults to GOMAXPROCS.
-	PARALLEL_THRESHOLD int // Size threshold to use parallelization. Defaults to 8.
+	GOROUTINE_CNT      int  // Number of goroutines to execute. Defaults to GOMAXPROCS.
+	PARALLEL_THRESHOLD int  // Size threshold to use parallelization. Defaults to 8.
+	CHECK_ORACLE       bool // Checks if oracles are valid before applying. Defaults to false.
+	FUSION_QUBITS      int  // Maximum number of qubits of fused gates. Defaults to 0, which disables gate fusion.
+	SINGLE_PRECISION   bool // Stores amplitudes as complex64, halving memory. Applied when the state is initialized. Defaults to false.
+	LAZY_TEMP          bool // Allocates the temp buffer only when needed by oracles or gates on more than 6 qubits. Defaults to false.
+	MAX_QUBITS         int  // Maximum number of qubits, up to 40. Defaults to 0, which derives the limit from the available memory.
+	NO_RECORD          bool // Executes instructions without recording them, so that memory does not grow. Defaults to false.
 }
 
-type Circuit struct {
-	state  Qubit   // State qubit of this circuit.
-	temp   Qubit   // Used for some apply functions.
-	Option Options // Options for this circuit.
+// DefaultOptions returns the default options of NewCircuit.
+func DefaultOptions() Options {
+	return Options{GOROUTINE_CNT: runtime.GOMAXPROCS(0), PARALLEL_THRESHOLD: 10}
 }
 
-// Clears temp qubit.
-func (c *Circuit) cleartemp() {
-	for i := range c.temp.data {
-		c.temp.data[i] = 0
-	}
+type Circuit struct {
+	size    int                 // Number of qubits.
+	state   stateVector         // State vector of this circuit. nil if the circuit only records instructions.
+	init    int                 // Initial basis state, used when replaying.
+	cbits   []int               // Classical bits.
+	qregs   []QuantumRegister   // Named quantum registers.
+	qnames  []string            // Names of quantum registers.
+	cregs   []ClassicalRegister // Named classical registers.
+	cnames  []string            // Names of classical registers.
+	insts   []Instruction       // Recorded instructions.
+	cond    *Condition          // Condition of instructions inside CIf.
+	norun   bool                // True if instructions are only recorded, and never executed.
+	pending fuser               // Gates waiting to be applied, if gate fusion is enabled.
+	workers *pool               // Worker goroutines of parallel kernels, started on the first use.
+	blocks  map[int]block       // Instructions executed by a single kernel, indexed by the first instruction.
+	Option  Options             // Options for this circuit.
 }
 
 // NewCircuit initializes circuit with nbits size.
+// Circuit with zero qubits can be used to allocate registers later.
 func NewCircuit(nbits int) *Circuit {
-	if nbits < 0 || nbits > 24 {
-		panic("Unsupported amount of qubits. Currently qsim supports up to 20 qubits.")
-	}
+	return NewCircuitWithOptions(nbits, DefaultOptions())
+}
+
+// NewCircuitWithOptions initializes circuit with nbits size and options opt.
+// The number of qubits is limited by MAX_QUBITS, or by the available memory.
+// Use EstimateMemory or Options.EstimateMemory to see the memory needed.
+// Without MAX_QUBITS, circuits of more than 24 qubits, or 25 in single precision,
+// are checked against the memory available at the call,
+// so the same call may succeed or panic depending on the machine and its load.
+// Set MAX_QUBITS for reproducible behavior.
+func NewCircuitWithOptions(nbits int, opt Options) *Circuit {
+	opt.checkQubits(nbits)
 
 	return &Circuit{
-		state:  NewBit(0, nbits),
-		temp:   NewQubit(vec.NewVec(1 << nbits)),
-		Option: Options{GOROUTINE_CNT: runtime.GOMAXPROCS(0), PARALLEL_THRESHOLD: 10},
+		size:   nbits,
+		state:  newState(0, nbits, opt),
+		cbits:  make([]int, 0),
+		insts:  make([]Instruction, 0),
+		Option: opt,
 	}
 }
 
 // SetBit sets the state qubit to given number.
+// This is also used as the initial state when the circuit is replayed.
 func (c *Circuit) SetBit(n int) {
-	c.state = NewBit(n, c.Size())
+	c.flush()
+	c.state = newState(n, c.Size(), c.Option)
+	c.init = n
 }
 
 // Size returns the qubit length of this circuit.
 func (c Circuit) Size() int {
-	return c.state.size
+	return c.size
 }
 
 // State returns the copy of this circuit's state.
-func (c Circuit) State() Qubit {
-	return c.state.Copy()
+func (c *Circuit) State() Qubit {
+	if c.state == nil {
+		return Qubit{size: c.Size()}
+	}
+
+	c.flush()
+	return c.state.qubit()
 }
 
 // Gates.
 
 // Applies the I gate.
 func (c *Circuit) I(iregs ...int) {
-	// Just Do Nothing. lol.
+	if len(iregs) == 0 {
+		panic("At least one input registers required.")
+	}
+
+	// Only recorded, since the I gate does nothing.
+	for _, i := range iregs {
+		c.Apply(I(), i)
+	}
 }
 
 // Applies the X gate.
@@ -99,14 +142,25 @@ func (c *Circuit) Z(iregs ...int) {
 }
 
 // Applies the H gate.
+// H on several distinct qubits is applied at once by fast Walsh-Hadamard transform.
 func (c *Circuit) H(iregs ...int) {
 	if len(iregs) == 0 {
 		panic("At least one input registers required.")
 	}
 
-	for _, i := range iregs {
-		c.Apply(H(), i)
+	emit := func() {
+		for _, i := range iregs {
+			c.Apply(H(), i)
+		}
 	}
+
+	if len(iregs) == 1 || slice.HasDuplicate(iregs) {
+		emit()
+		return
+	}
+
+	regs := append([]int{}, iregs...)
+	c.fast(emit, func(c *Circuit) { c.state.hadamard(c, regs) })
 }
 
 // Applies the P gate.
@@ -142,6 +196,61 @@ func (c *Circuit) T(iregs ...int) {
 	}
 }
 
+// Applies the SX gate.
+func (c *Circuit) SX(iregs ...int) {
+	if len(iregs) == 0 {
+		panic("At least one input registers required.")
+	}
+
+	for _, i := range iregs {
+		c.Apply(SX(), i)
+	}
+}
+
+// Applies the RX gate.
+func (c *Circuit) RX(theta float64, iregs ...int) {
+	if len(iregs) == 0 {
+		panic("At least one input registers required.")
+	}
+
+	for _, i := range iregs {
+		c.Apply(RX(theta), i)
+	}
+}
+
+// Applies the RY gate.
+func (c *Circuit) RY(theta float64, iregs ...int) {
+	if len(iregs) == 0 {
+		panic("At least one input registers required.")
+	}
+
+	for _, i := range iregs {
+		c.Apply(RY(theta), i)
+	}
+}
+
+// Applies the RZ gate.
+func (c *Circuit) RZ(theta float64, iregs ...int) {
+	if len(iregs) == 0 {
+		panic("At least one input registers required.")
+	}
+
+	for _, i := range iregs {
+		c.Apply(RZ(theta), i)
+	}
+}
+
+// Applies the U3 gate.
+func (c *Circuit) U3(theta, phi, lambda float64, iregs ...int) {
+	if len(iregs) == 0 {
+		panic("At least one input registers required.")
+	}
+
+	for _, i := range iregs {
+		c.Apply(U3(theta, phi, lambda), i)
+	}
+}
+
 // Applies the CX gate.
 func (circ *Circuit) CX(c0, i int) {
 	circ.Control(X(), []int{c0}, []int{i})
@@ -164,7 +273,7 @@ func (c *Circuit) Apply(op Gate, iregs ...int) {
 		panic("Operator size does not match input registers.")
 	}
 
-	if number.Min(iregs...) < 0 || number.Max(iregs...) > c.Size() {
+	if number.Min(iregs...) < 0 || number.Max(iregs...) >= c.Size() {
 		panic("Registers out of range.")
 	}
 
@@ -172,98 +281,123 @@ func (c *Circuit) Apply(op Gate, iregs ...int) {
 		panic("Duplicate registers.")
 	}
 
+	c.exec(Instruction{Kind: KindGate, Gate: op, Targets: iregs})
+}
+
+// applyGate applies the given gate to the state.
+func (v *vector[T]) applyGate(c *Circuit, op Gate, iregs []int) {
+	switch {
+	case op.is(I()):
+		return
+	case op.is(SWAP()):
+		v.swap(c, iregs[0], iregs[1])
+		return
+	}
+
+	if len(iregs) <= maxDense && v.applySpecial(c, op, 0, iregs) {
+		return
+	}
+
 	// Special treatment for one and two qubit gates.
 	if c.Size() > c.Option.PARALLEL_THRESHOLD {
 		switch len(iregs) {
 		case 1:
-			c.applyOneParallel(op, iregs[0])
+			v.applyOneParallel(c, op, iregs[0])
 			return
 		case 2:
-			c.applyTwoParallel(op, iregs[0], iregs[1])
+			v.applyTwoParallel(c, op, iregs[0], iregs[1])
 			return
 		}
 	} else {
 		switch len(iregs) {
 		case 1:
-			c.applyOne(op, iregs[0])
+			v.applyOne(c, op, iregs[0])
 			return
 		case 2:
-			c.applyTwo(op, iregs[0], iregs[1])
+			v.applyTwo(c, op, iregs[0], iregs[1])
 			return
 		}
 	}
 
-	c.applyGeneral(op, iregs...)
+	if len(iregs) <= maxDense {
+		v.applyDense(c, op, 0, iregs)
+		return
+	}
+
+	v.applyGeneral(c, op, iregs...)
 }
 
 // applyOne applies one qubit gate.
-func (c *Circuit) applyOne(op Gate, i int) {
+func (v *vector[T]) applyOne(c *Circuit, op Gate, i int) {
+	m := matrix[T](op)
+
 	mask := (1 << i) - 1
 
-	for n := 0; n < c.state.Dim()/2; n++ {
+	for n := 0; n < len(v.data)/2; n++ {
 		// n0 = XXX0XXX, n1 = XXX1XXX
 		n0 := ((n & ^mask) << 1) + (n & mask)
 		n1 := n0 | (mask + 1)
 
-		a0 := c.state.data[n0]
-		a1 := c.state.data[n1]
+		a0 := v.data[n0]
+		a1 := v.data[n1]
 
-		c.state.data[n0] = a0*op.data[0][0] + a1*op.data[0][1]
-		c.state.data[n1] = a0*op.data[1][0] + a1*op.data[1][1]
+		v.data[n0] = a0*m[0][0] + a1*m[0][1]
+		v.data[n1] = a0*m[1][0] + a1*m[1][1]
 	}
 }
 
 // applyOneParallel applies one qubit gate with parallelization.
-func (c *Circuit) applyOneParallel(op Gate, i int) {
-	jobsize := c.state.Dim() / 2
-	chunksize := jobsize / c.Option.GOROUTINE_CNT
-
-	chunkidx := make([]int, c.Option.GOROUTINE_CNT+1)
-	for i := 0; i < c.Option.GOROUTINE_CNT; i++ {
-		chunkidx[i] = i * chunksize
-	}
-	chunkidx[c.Option.GOROUTINE_CNT] = jobsize
-
-	var wg sync.WaitGroup
-	wg.Add(c.Option.GOROUTINE_CNT)
+func (v *vector[T]) applyOneParallel(c *Circuit, op Gate, i int) {
+	m := matrix[T](op)
 
+	jobsize := len(v.data) / 2
 	mask := (1 << i) - 1
 
-	for n := 0; n < c.Option.GOROUTINE_CNT; n++ {
-		go func(start, end int) {
-			defer wg.Done()
+	c.parallel(jobsize, func(start, end int) {
+		for n := start; n < end; n++ {
+			n0 := ((n & ^mask) << 1) + (n & mask)
+			n1 := n0 | (mask + 1)
 
-			for n := start; n < end; n++ {
-				n0 := ((n & ^mask) << 1) + (n & mask)
-				n1 := n0 | (mask + 1)
+			a0 := v.data[n0]
+			a1 := v.data[n1]
 
-				a0 := c.state.data[n0]
-				a1 := c.state.data[n1]
+			v.data[n0] = a0*m[0][0] + a1*m[0][1]
+			v.data[n1] = a0*m[1][0] + a1*m[1][1]
+		}
+	})
+}
 
-				c.state.data[n0] = a0*op.data[0][0] + a1*op.data[0][1]
-				c.state.data[n1] = a0*op.data[1][0] + a1*op.data[1][1]
-			}
-		}(chunkidx[n], chunkidx[n+1])
+// swapped returns the two qubit gate with its qubits swapped.
+func (op Gate) swapped() Gate {
+	// Conjugate by SWAP, which exchanges |01> and |10>.
+	perm := [4]int{0, 2, 1, 3}
+	m := make([][]complex128, 4)
+	for i := range m {
+		m[i] = make([]complex128, 4)
+		for j := range m[i] {
+			m[i][j] = op.data[perm[i]][perm[j]]
+		}
 	}
 
-	wg.Wait()
+	return Gate{data: m, size: 2, name: op.name, params: op.params}
 }
 
 // applyTwo applies two qubit gate.
-func (c *Circuit) applyTwo(op Gate, i0, i1 int) {
+func (v *vector[T]) applyTwo(c *Circuit, op Gate, i0, i1 int) {
 	if i0 == i1 {
 		panic("Cannot apply gate to same registers.")
 	}
 
 	if i0 > i1 {
 		i0, i1 = i1, i0
-		op.data[1], op.data[2] = op.data[2], op.data[1]
+		op = op.swapped()
 	}
+	m := matrix[T](op)
 
 	mask0 := (1 << i0) - 1
 	mask1 := (1 << i1) - 1
 
-	for n := 0; n < c.state.Dim()/4; n++ {
+	for n := 0; n < len(v.data)/4; n++ {
 		// n00 = XXX0(i1)XXX0(i0)XXX
 		// n01 = XXX0(i1)XXX1(i0)XXX
 		// ...
@@ -275,72 +409,58 @@ func (c *Circuit) applyTwo(op Gate, i0, i1 int) {
 		n10 := n00 | (mask1 + 1)
 		n11 := n10 | (mask0 + 1)
 
-		a00 := c.state.data[n00]
-		a01 := c.state.data[n01]
-		a10 := c.state.data[n10]
-		a11 := c.state.data[n11]
+		a00 := v.data[n00]
+		a01 := v.data[n01]
+		a10 := v.data[n10]
+		a11 := v.data[n11]
 
-		c.state.data[n00] = a00*op.data[0][0] + a01*op.data[0][1] + a10*op.data[0][2] + a11*op.data[0][3]
-		c.state.data[n01] = a00*op.data[1][0] + a01*op.data[1][1] + a10*op.data[1][2] + a11*op.data[1][3]
-		c.state.data[n10] = a00*op.data[2][0] + a01*op.data[2][1] + a10*op.data[2][2] + a11*op.data[2][3]
-		c.state.data[n11] = a00*op.data[3][0] + a01*op.data[3][1] + a10*op.data[3][2] + a11*op.data[3][3]
+		v.data[n00] = a00*m[0][0] + a01*m[0][1] + a10*m[0][2] + a11*m[0][3]
+		v.data[n01] = a00*m[1][0] + a01*m[1][1] + a10*m[1][2] + a11*m[1][3]
+		v.data[n10] = a00*m[2][0] + a01*m[2][1] + a10*m[2][2] + a11*m[2][3]
+		v.data[n11] = a00*m[3][0] + a01*m[3][1] + a10*m[3][2] + a11*m[3][3]
 	}
 }
 
 // applyTwoParallel applies two qubit gate with parallelizaition.
-func (c *Circuit) applyTwoParallel(op Gate, i0, i1 int) {
-	jobsize := c.state.Dim() / 4
-	chunksize := jobsize / c.Option.GOROUTINE_CNT
-
-	chunkidx := make([]int, c.Option.GOROUTINE_CNT+1)
-	for i := 0; i < c.Option.GOROUTINE_CNT; i++ {
-		chunkidx[i] = i * chunksize
-	}
-	chunkidx[c.Option.GOROUTINE_CNT] = jobsize
-
-	var wg sync.WaitGroup
-	wg.Add(c.Option.GOROUTINE_CNT)
-
+func (v *vector[T]) applyTwoParallel(c *Circuit, op Gate, i0, i1 int) {
+	jobsize := len(v.data) / 4
 	if i0 > i1 {
 		i0, i1 = i1, i0
-		op.data[1], op.data[2] = op.data[2], op.data[1]
+		op = op.swapped()
 	}
+	m := matrix[T](op)
 
 	mask0 := (1 << i0) - 1
 	mask1 := (1 << i1) - 1
 
-	for n := 0; n < c.Option.GOROUTINE_CNT; n++ {
-		go func(start, end int) {
-			defer wg.Done()
+	c.parallel(jobsize, func(start, end int) {
+		for n := start; n < end; n++ {
+			t := ((n & ^mask0) << 1) + (n & mask0)
 
-			for n := start; n < end; n++ {
-				t := ((n & ^mask0) << 1) + (n & mask0)
+			n00 := ((t & ^mask1) << 1) + (t & mask1)
+			n01 := n00 | (mask0 + 1)
+			n10 := n00 | (mask1 + 1)
+			n11 := n10 | (mask0 + 1)
 
-				n00 := ((t & ^mask1) << 1) + (t & mask1)
-				n01 := n00 | (mask0 + 1)
-				n10 := n00 | (mask1 + 1)
-				n11 := n10 | (mask0 + 1)
+			a00 := v.data[n00]
+			a01 := v.data[n01]
+			a10 := v.data[n10]
+			a11 := v.data[n11]
 
-				a00 := c.state.data[n00]
-				a01 := c.state.data[n01]
-				a10 := c.state.data[n10]
-				a11 := c.state.data[n11]
-
-				c.state.data[n00] = a00*op.data[0][0] + a01*op.data[0][1] + a10*op.data[0][2] + a11*op.data[0][3]
-				c.state.data[n01] = a00*op.data[1][0] + a01*op.data[1][1] + a10*op.data[1][2] + a11*op.data[1][3]
-				c.state.data[n10] = a00*op.data[2][0] + a01*op.data[2][1] + a10*op.data[2][2] + a11*op.data[2][3]
-				c.state.data[n11] = a00*op.data[3][0] + a01*op.data[3][1] + a10*op.data[3][2] + a11*op.data[3][3]
-			}
-		}(chunkidx[n], chunkidx[n+1])
-	}
-
-	wg.Wait()
+			v.data[n00] = a00*m[0][0] + a01*m[0][1] + a10*m[0][2] + a11*m[0][3]
+			v.data[n01] = a00*m[1][0] + a01*m[1][1] + a10*m[1][2] + a11*m[1][3]
+			v.data[n10] = a00*m[2][0] + a01*m[2][1] + a10*m[2][2] + a11*m[2][3]
+			v.data[n11] = a00*m[3][0] + a01*m[3][1] + a10*m[3][2] + a11*m[3][3]
+		}
+	})
 }
 
 // applyGeneral applies gate to this circuit.
-func (c *Circuit) applyGeneral(op Gate, iregs ...int) {
-	c.cleartemp()
-	for basis, amp := range c.state.data {
+func (v *vector[T]) applyGeneral(c *Circuit, op Gate, iregs ...int) {
+	m := matrix[T](op)
+
+	v.cleartemp()
+	for basis, amp := range v.data {
 		if amp == 0 {
 			continue
 		}
@@ -356,7 +476,7 @@ func (c *Circuit) applyGeneral(op Gate, iregs ...int) {
 		// Note that ibasis is just a basis state.
 		// This means that applying is taking columns from gate.
 		for newibasis := 0; newibasis < (1 << len(iregs)); newibasis++ {
-			newamp := op.data[newibasis][ibasis]
+			newamp := m[newibasis][ibasis]
 			if newamp == 0 {
 				continue
 			}
@@ -366,16 +486,40 @@ func (c *Circuit) applyGeneral(op Gate, iregs ...int) {
 				bit := (newibasis >> idx) & 1
 				newbasis = (newbasis | (1 << val)) - ((bit ^ 1) << val)
 			}
-			c.temp.data[newbasis] += amp * newamp
+			v.temp[newbasis] += amp * newamp
 		}
 	}
 
-	c.state, c.temp = c.temp, c.state
+	v.data, v.temp = v.temp, v.data
 }
 
 // ApplyOracle applies the oracle f to circuit. Maps |x>_{iregs}|y>_{oregs} -> |x>_{iregs}|y^f(x)>_{oregs}.
-// NOTE: This function DOES NOT check if oracle is unitary. Use at your own risk.
+// NOTE: This function DOES NOT check if oracle is unitary, unless Option.CHECK_ORACLE is set. Use at your own risk.
+// Use CheckOracle to get the error of an invalid oracle, instead of a panic.
 func (c *Circuit) ApplyOracle(oracle func(int) int, iregs []int, oregs []int) {
+	c.checkOracleRegisters(iregs, oregs)
+
+	c.exec(Instruction{Kind: KindOracle, Oracle: oracle, Targets: iregs, Outputs: oregs})
+}
+
+// CheckOracle checks if applying oracle to the current state with ApplyOracle maps every basis state
+// with nonzero amplitude to a distinct basis state, and if every output of oracle fits in oregs.
+// If not, it returns an error describing the first few collisions. The state is not changed.
+// Circuits which only record instructions have no state, so nil is returned.
+func (c *Circuit) CheckOracle(oracle func(int) int, iregs []int, oregs []int) error {
+	c.checkOracleRegisters(iregs, oregs)
+
+	if c.state == nil {
+		return nil
+	}
+
+	c.flush()
+	_, err := c.state.checkOracle(c, oracle, iregs, oregs)
+	return err
+}
+
+// checkOracleRegisters panics if iregs and oregs are not valid registers of an oracle.
+func (c *Circuit) checkOracleRegisters(iregs, oregs []int) {
 	if len(iregs) == 0 || len(oregs) == 0 {
 		panic("Invalid input/output registers.")
 	}
@@ -395,14 +539,35 @@ func (c *Circuit) ApplyOracle(oracle func(int) int, iregs []int, oregs []int) {
 	if slice.HasCommon(iregs, oregs) {
 		panic("Duplicate registers.")
 	}
+}
 
-	if c.state.Dim() > c.Option.PARALLEL_THRESHOLD {
-		c.applyOracleParallel(oracle, iregs, oregs)
+// applyOracle applies the oracle to the state.
+func (v *vector[T]) applyOracle(c *Circuit, oracle func(int) int, iregs, oregs []int) {
+	if c.Option.CHECK_ORACLE {
+		// Outputs are computed once, so that the checked values are the applied values.
+		targets, err := v.checkOracle(c, oracle, iregs, oregs)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		v.cleartemp()
+		for basis, t := range targets {
+			if t >= 0 {
+				v.temp[t] = v.data[basis]
+			}
+		}
+
+		v.data, v.temp = v.temp, v.data
+		return
+	}
+
+	if len(v.data) > c.Option.PARALLEL_THRESHOLD {
+		v.applyOracleParallel(c, oracle, iregs, oregs)
 		return
 	}
 
-	c.cleartemp()
-	for basis, amp := range c.state.data {
+	v.cleartemp()
+	for basis, amp := range v.data {
 		if amp == 0 {
 			continue
 		}
@@ -419,284 +584,239 @@ func (c *Circuit) ApplyOracle(oracle func(int) int, iregs []int, oregs []int) {
 			newbasis ^= ((output >> idx) & 1) << val
 		}
 
-		c.temp.data[newbasis] = amp
+		v.temp[newbasis] = amp
 	}
 
-	c.state, c.temp = c.temp, c.state
+	v.data, v.temp = v.temp, v.data
 }
 
 // applyOracleParallel applies oracle with parallelizaiton.
-func (c *Circuit) applyOracleParallel(oracle func(int) int, iregs, oregs []int) {
-	c.cleartemp()
-
-	jobsize := c.state.Dim()
-	chunksize := jobsize / c.Option.GOROUTINE_CNT
+func (v *vector[T]) applyOracleParallel(c *Circuit, oracle func(int) int, iregs, oregs []int) {
+	v.cleartemp()
+
+	jobsize := len(v.data)
+	c.parallel(jobsize, func(start, end int) {
+		for basis := start; basis < end; basis++ {
+			amp := v.data[basis]
+			if amp == 0 {
+				continue
+			}
 
-	chunkidx := make([]int, c.Option.GOROUTINE_CNT+1)
-	for i := 0; i < c.Option.GOROUTINE_CNT; i++ {
-		chunkidx[i] = i * chunksize
-	}
-	chunkidx[c.Option.GOROUTINE_CNT] = jobsize
+			input := 0
+			for idx, val := range iregs {
+				input += ((basis >> val) & 1) << idx
+			}
 
-	var wg sync.WaitGroup
-	wg.Add(c.Option.GOROUTINE_CNT)
+			output := oracle(input)
 
-	for n := 0; n < c.Option.GOROUTINE_CNT; n++ {
-		go func(start, end int) {
-			defer wg.Done()
+			newbasis := basis
+			for idx, val := range oregs {
+				newbasis ^= ((output >> idx) & 1) << val
+			}
 
-			for basis := start; basis < end; basis++ {
-				amp := c.state.data[basis]
-				if amp == 0 {
-					continue
-				}
+			v.temp[newbasis] = amp
+		}
+	})
 
-				input := 0
-				for idx, val := range iregs {
-					input += ((basis >> val) & 1) << idx
-				}
+	v.data, v.temp = v.temp, v.data
+}
 
-				output := oracle(input)
+// checkOracle checks if oracle maps every basis state with nonzero amplitude to a distinct basis state,
+// and if every output of oracle fits in oregs.
+// It returns the image of each basis state, or -1 if its amplitude is zero.
+// If the oracle is invalid, it returns an error describing the first few collisions.
+func (v *vector[T]) checkOracle(c *Circuit, oracle func(int) int, iregs, oregs []int) ([]int, error) {
+	const maxReports = 4
 
-				newbasis := basis
-				for idx, val := range oregs {
-					newbasis ^= ((output >> idx) & 1) << val
-				}
+	// newbasis -> basis
+	image := make(map[int]int)
+	errs := make([]string, 0)
+	targets := make([]int, len(v.data))
 
-				c.temp.data[newbasis] = amp
-			}
-		}(chunkidx[n], chunkidx[n+1])
-	}
+	for basis, amp := range v.data {
+		targets[basis] = -1
+		if amp == 0 {
+			continue
+		}
 
-	wg.Wait()
+		input := 0
+		for idx, val := range iregs {
+			input += ((basis >> val) & 1) << idx
+		}
 
-	c.state, c.temp = c.temp, c.state
-}
+		output := oracle(input)
+		if output < 0 || output >= 1<<len(oregs) {
+			if len(errs) < maxReports {
+				errs = append(errs, fmt.Sprintf("f(%d) = %d does not fit in %d registers", input, output, len(oregs)))
+			}
+		}
 
-// Control.
+		newbasis := basis
+		for idx, val := range oregs {
+			newbasis ^= ((output >> idx) & 1) << val
+		}
 
-// Used for calculating control bits in control-functions.
-func checkControlBit(n int, cregs []int) bool {
-	for _, idx := range cregs {
-		if (n>>idx)&1 == 0 {
-			return false
+		if prev, ok := image[newbasis]; ok {
+			if len(errs) < maxReports {
+				errs = append(errs, fmt.Sprintf("|%0*b> and |%0*b> both map to |%0*b>", c.Size(), prev, c.Size(), basis, c.Size(), newbasis))
+			}
+			continue
 		}
+		image[newbasis] = basis
+		targets[basis] = newbasis
 	}
 
-	return true
-}
-
-// Control applies controlled gate.
-func (c *Circuit) Control(op Gate, cregs, iregs []int) {
-	if len(iregs) == 0 {
-		panic("At least one input registers required.")
+	if len(errs) == 0 {
+		return targets, nil
 	}
 
-	if len(iregs) != op.Size() {
-		panic("Operator size does not match input registers.")
+	msg := "Invalid oracle:"
+	for _, e := range errs {
+		msg += "\n\t" + e
 	}
 
-	if number.Min(cregs...) < 0 || number.Max(cregs...) > c.Size() {
-		panic("Registers out of range.")
-	}
+	return nil, errors.New(msg)
+}
 
-	if number.Min(iregs...) < 0 || number.Max(iregs...) > c.Size() {
-		panic("Registers out of range.")
+// ApplyPhaseOracle applies the phase oracle f to circuit. Maps |x>_{iregs} -> (-1)^f(x)|x>_{iregs}.
+// Unlike ApplyOracle, this does not require an output register.
+func (c *Circuit) ApplyPhaseOracle(oracle func(int) bool, iregs ...int) {
+	if len(iregs) == 0 {
+		panic("Invalid input registers.")
 	}
 
-	if slice.HasDuplicate(cregs) || slice.HasDuplicate(iregs) {
-		panic("Duplicate registers.")
+	if number.Min(iregs...) < 0 || number.Max(iregs...) >= c.Size() {
+		panic("Register index out of range.")
 	}
 
-	if slice.HasCommon(cregs, iregs) {
+	if slice.HasDuplicate(iregs) {
 		panic("Duplicate registers.")
 	}
 
-	// Special treatment for one and two qubit gates.
-	if c.Size() > c.Option.PARALLEL_THRESHOLD {
-		switch len(iregs) {
-		case 1:
-			c.controlOneParallel(op, cregs, iregs[0])
-			return
-		case 2:
-			c.controlTwoParallel(op, cregs, iregs[0], iregs[1])
-			return
-		}
-	} else {
-		switch len(iregs) {
-		case 1:
-			c.controlOne(op, cregs, iregs[0])
-			return
-		case 2:
-			c.controlTwo(op, cregs, iregs[0], iregs[1])
-			return
-		}
-	}
-
-	c.controlGeneral(op, cregs, iregs)
+	c.exec(Instruction{Kind: KindPhaseOracle, PhaseOracle: oracle, Targets: iregs})
 }
 
-// controlOne applies one qubit controlled gate.
-func (c *Circuit) controlOne(op Gate, cregs []int, i int) {
-	mask := (1 << i) - 1
-
-	for n := 0; n < c.state.Dim()/2; n++ {
-		n0 := ((n & ^mask) << 1) + (n & mask)
-		n1 := n0 | (mask + 1)
+// applyPhaseOracle applies the phase oracle to the state.
+func (v *vector[T]) applyPhaseOracle(c *Circuit, oracle func(int) bool, iregs []int) {
+	if c.Size() > c.Option.PARALLEL_THRESHOLD {
+		v.applyPhaseOracleParallel(c, oracle, iregs)
+		return
+	}
 
-		if !checkControlBit(n0, cregs) {
+	for basis, amp := range v.data {
+		if amp == 0 {
 			continue
 		}
 
-		a0 := c.state.data[n0]
-		a1 := c.state.data[n1]
+		input := 0
+		for idx, val := range iregs {
+			input += ((basis >> val) & 1) << idx
+		}
 
-		c.state.data[n0] = a0*op.data[0][0] + a1*op.data[0][1]
-		c.state.data[n1] = a0*op.data[1][0] + a1*op.data[1][1]
+		if oracle(input) {
+			v.data[basis] = -amp
+		}
 	}
 }
 
-// controlOneParallel applies one qubit controlled gate with parallelization.
-func (c *Circuit) controlOneParallel(op Gate, cregs []int, i int) {
-	jobsize := c.state.Dim() / 2
-	chunksize := jobsize / c.Option.GOROUTINE_CNT
-
-	chunkidx := make([]int, c.Option.GOROUTINE_CNT+1)
-	for i := 0; i < c.Option.GOROUTINE_CNT; i++ {
-		chunkidx[i] = i * chunksize
-	}
-	chunkidx[c.Option.GOROUTINE_CNT] = jobsize
-
-	var wg sync.WaitGroup
-	wg.Add(c.Option.GOROUTINE_CNT)
-
-	mask := (1 << i) - 1
-
-	for n := 0; n < c.Option.GOROUTINE_CNT; n++ {
-		go func(start, end int) {
-			defer wg.Done()
-
-			for n := start; n < end; n++ {
-				n0 := ((n & ^mask) << 1) + (n & mask)
-				n1 := n0 | (mask + 1)
-
-				if !checkControlBit(n0, cregs) {
-					continue
-				}
-
-				a0 := c.state.data[n0]
-				a1 := c.state.data[n1]
+// applyPhaseOracleParallel applies phase oracle with parallelization.
+func (v *vector[T]) applyPhaseOracleParallel(c *Circuit, oracle func(int) bool, iregs []int) {
+	jobsize := len(v.data)
+	c.parallel(jobsize, func(start, end int) {
+		for basis := start; basis < end; basis++ {
+			amp := v.data[basis]
+			if amp == 0 {
+				continue
+			}
 
-				c.state.data[n0] = a0*op.data[0][0] + a1*op.data[0][1]
-				c.state.data[n1] = a0*op.data[1][0] + a1*op.data[1][1]
+			input := 0
+			for idx, val := range iregs {
+				input += ((basis >> val) & 1) << idx
 			}
-		}(chunkidx[n], chunkidx[n+1])
-	}
 
-	wg.Wait()
+			if oracle(input) {
+				v.data[basis] = -amp
+			}
+		}
+	})
 }
 
-// controlTwo applies two qubit controlled gate.
-func (c *Circuit) controlTwo(op Gate, cregs []int, i0, i1 int) {
-	if i0 == i1 {
-		panic("Cannot apply gate to same registers.")
-	}
+// Control.
 
-	if i0 > i1 {
-		i0, i1 = i1, i0
-		op.data[1], op.data[2] = op.data[2], op.data[1]
+// Control applies controlled gate.
+func (c *Circuit) Control(op Gate, cregs, iregs []int) {
+	if len(iregs) == 0 {
+		panic("At least one input registers required.")
 	}
 
-	mask0 := (1 << i0) - 1
-	mask1 := (1 << i1) - 1
-
-	for n := 0; n < c.state.Dim()/4; n++ {
-		t := ((n & ^mask0) << 1) + (n & mask0)
-
-		n00 := ((t & ^mask1) << 1) + (t & mask1)
-		n01 := n00 | (mask0 + 1)
-		n10 := n00 | (mask1 + 1)
-		n11 := n10 | (mask0 + 1)
-
-		if !checkControlBit(n00, cregs) {
-			continue
-		}
-
-		a00 := c.state.data[n00]
-		a01 := c.state.data[n01]
-		a10 := c.state.data[n10]
-		a11 := c.state.data[n11]
-
-		c.state.data[n00] = a00*op.data[0][0] + a01*op.data[0][1] + a10*op.data[0][2] + a11*op.data[0][3]
-		c.state.data[n01] = a00*op.data[1][0] + a01*op.data[1][1] + a10*op.data[1][2] + a11*op.data[1][3]
-		c.state.data[n10] = a00*op.data[2][0] + a01*op.data[2][1] + a10*op.data[2][2] + a11*op.data[2][3]
-		c.state.data[n11] = a00*op.data[3][0] + a01*op.data[3][1] + a10*op.data[3][2] + a11*op.data[3][3]
+	if len(iregs) != op.Size() {
+		panic("Operator size does not match input registers.")
 	}
-}
 
-// controlTwoParallel applies two qubit controlled gate. with parallelizaition.
-func (c *Circuit) controlTwoParallel(op Gate, cregs []int, i0, i1 int) {
-	jobsize := c.state.Dim() / 4
-	chunksize := jobsize / c.Option.GOROUTINE_CNT
-
-	chunkidx := make([]int, c.Option.GOROUTINE_CNT+1)
-	for i := 0; i < c.Option.GOROUTINE_CNT; i++ {
-		chunkidx[i] = i * chunksize
+	if len(cregs) == 0 {
+		c.Apply(op, iregs...)
+		return
 	}
-	chunkidx[c.Option.GOROUTINE_CNT] = jobsize
 
-	var wg sync.WaitGroup
-	wg.Add(c.Option.GOROUTINE_CNT)
-
-	if i0 > i1 {
-		i0, i1 = i1, i0
-		op.data[1], op.data[2] = op.data[2], op.data[1]
+	if number.Min(cregs...) < 0 || number.Max(cregs...) >= c.Size() {
+		panic("Registers out of range.")
 	}
 
-	mask0 := (1 << i0) - 1
-	mask1 := (1 << i1) - 1
+	if number.Min(iregs...) < 0 || number.Max(iregs...) >= c.Size() {
+		panic("Registers out of range.")
+	}
 
-	for n := 0; n < c.Option.GOROUTINE_CNT; n++ {
-		go func(start, end int) {
-			defer wg.Done()
+	if slice.HasDuplicate(cregs) || slice.HasDuplicate(iregs) {
+		panic("Duplicate registers.")
+	}
 
-			for n := start; n < end; n++ {
-				t := ((n & ^mask0) << 1) + (n & mask0)
+	if slice.HasCommon(cregs, iregs) {
+		panic("Duplicate registers.")
+	}
 
-				n00 := ((t & ^mask1) << 1) + (t & mask1)
-				n01 := n00 | (mask0 + 1)
-				n10 := n00 | (mask1 + 1)
-				n11 := n10 | (mask0 + 1)
+	c.exec(Instruction{Kind: KindGate, Gate: op, Controls: cregs, Targets: iregs})
+}
 
-				if !checkControlBit(n00, cregs) {
-					continue
-				}
+// controlGate applies the given controlled gate to the state.
+// Only amplitudes with every control bit set are visited.
+func (v *vector[T]) controlGate(c *Circuit, op Gate, cregs, iregs []int) {
+	if op.is(I()) {
+		return
+	}
 
-				a00 := c.state.data[n00]
-				a01 := c.state.data[n01]
-				a10 := c.state.data[n10]
-				a11 := c.state.data[n11]
+	cmask := bitmask(cregs)
+	if len(iregs) > maxDense {
+		v.controlGeneral(c, op, cmask, iregs)
+		return
+	}
 
-				c.state.data[n00] = a00*op.data[0][0] + a01*op.data[0][1] + a10*op.data[0][2] + a11*op.data[0][3]
-				c.state.data[n01] = a00*op.data[1][0] + a01*op.data[1][1] + a10*op.data[1][2] + a11*op.data[1][3]
-				c.state.data[n10] = a00*op.data[2][0] + a01*op.data[2][1] + a10*op.data[2][2] + a11*op.data[2][3]
-				c.state.data[n11] = a00*op.data[3][0] + a01*op.data[3][1] + a10*op.data[3][2] + a11*op.data[3][3]
-			}
-		}(chunkidx[n], chunkidx[n+1])
+	if v.applySpecial(c, op, cmask, iregs) {
+		return
 	}
 
-	wg.Wait()
+	switch len(iregs) {
+	case 1:
+		v.controlOne(c, op, cmask, iregs[0])
+	case 2:
+		v.controlTwo(c, op, cmask, iregs[0], iregs[1])
+	default:
+		v.applyDense(c, op, cmask, iregs)
+	}
 }
 
 // controlGeneral applies controlled gate to this circuit.
-func (c *Circuit) controlGeneral(op Gate, cregs, iregs []int) {
-	c.cleartemp()
-	for basis, amp := range c.state.data {
+func (v *vector[T]) controlGeneral(c *Circuit, op Gate, cmask int, iregs []int) {
+	m := matrix[T](op)
+
+	v.cleartemp()
+	for basis, amp := range v.data {
 		if amp == 0 {
 			continue
 		}
 
-		if !checkControlBit(basis, cregs) {
+		// Amplitudes without control bits are left untouched.
+		if basis&cmask != cmask {
+			v.temp[basis] += amp
 			continue
 		}
 
@@ -706,7 +826,7 @@ func (c *Circuit) controlGeneral(op Gate, cregs, iregs []int) {
 		}
 
 		for newibasis := 0; newibasis < (1 << len(iregs)); newibasis++ {
-			newamp := op.data[newibasis][ibasis]
+			newamp := m[newibasis][ibasis]
 			if newamp == 0 {
 				continue
 			}
@@ -715,11 +835,11 @@ func (c *Circuit) controlGeneral(op Gate, cregs, iregs []int) {
 			for idx, val := range iregs {
 				newbasis = (newbasis | (1 << val)) - ((((newibasis >> idx) & 1) ^ 1) << val)
 			}
-			c.temp.data[newbasis] += amp * newamp
+			v.temp[newbasis] += amp * newamp
 		}
 	}
 
-	c.state, c.temp = c.temp, c.state
+	v.data, v.temp = v.temp, v.data
 }
 
 // Misc Gates.
@@ -734,13 +854,18 @@ func (c *Circuit) Swap(i0, i1 int) {
 		panic("Duplicate registers.")
 	}
 
+	c.exec(Instruction{Kind: KindGate, Gate: SWAP(), Targets: []int{i0, i1}})
+}
+
+// swap swaps two qubits of the state.
+func (v *vector[T]) swap(c *Circuit, i0, i1 int) {
 	if c.Size() == 2 {
-		c.state.data[0b01], c.state.data[0b10] = c.state.data[0b10], c.state.data[0b01]
+		v.data[0b01], v.data[0b10] = v.data[0b10], v.data[0b01]
 		return
 	}
 
 	if c.Size() > c.Option.PARALLEL_THRESHOLD {
-		c.swapParallel(i0, i1)
+		v.swapParallel(c, i0, i1)
 		return
 	}
 
@@ -751,31 +876,20 @@ func (c *Circuit) Swap(i0, i1 int) {
 	mask0 := (1 << i0) - 1
 	mask1 := (1 << i1) - 1
 
-	for n := 0; n < c.state.Dim()/4; n++ {
+	for n := 0; n < len(v.data)/4; n++ {
 		t := ((n & ^mask0) << 1) + (n & mask0)
 
 		n00 := ((t & ^mask1) << 1) + (t & mask1)
 		n01 := n00 | (mask0 + 1)
 		n10 := n00 | (mask1 + 1)
 
-		c.state.data[n01], c.state.data[n10] = c.state.data[n10], c.state.data[n01]
+		v.data[n01], v.data[n10] = v.data[n10], v.data[n01]
 	}
 }
 
 // swapParallel swaps to qubit with parallelization.
-func (c *Circuit) swapParallel(i0, i1 int) {
-	jobsize := c.state.Dim() / 4
-	chunksize := jobsize / c.Option.GOROUTINE_CNT
-
-	chunkidx := make([]int, c.Option.GOROUTINE_CNT+1)
-	for i := 0; i < c.Option.GOROUTINE_CNT; i++ {
-		chunkidx[i] = i * chunksize
-	}
-	chunkidx[c.Option.GOROUTINE_CNT] = jobsize
-
-	var wg sync.WaitGroup
-	wg.Add(c.Option.GOROUTINE_CNT)
-
+func (v *vector[T]) swapParallel(c *Circuit, i0, i1 int) {
+	jobsize := len(v.data) / 4
 	if i0 > i1 {
 		i0, i1 = i1, i0
 	}
@@ -783,27 +897,47 @@ func (c *Circuit) swapParallel(i0, i1 int) {
 	mask0 := (1 << i0) - 1
 	mask1 := (1 << i1) - 1
 
-	for n := 0; n < c.Option.GOROUTINE_CNT; n++ {
-		go func(start, end int) {
-			defer wg.Done()
+	c.parallel(jobsize, func(start, end int) {
+		for n := start; n < end; n++ {
+			t := ((n & ^mask0) << 1) + (n & mask0)
 
-			for n := start; n < end; n++ {
-				t := ((n & ^mask0) << 1) + (n & mask0)
+			n00 := ((t & ^mask1) << 1) + (t & mask1)
+			n01 := n00 | (mask0 + 1)
+			n10 := n00 | (mask1 + 1)
 
-				n00 := ((t & ^mask1) << 1) + (t & mask1)
-				n01 := n00 | (mask0 + 1)
-				n10 := n00 | (mask1 + 1)
+			v.data[n01], v.data[n10] = v.data[n10], v.data[n01]
+		}
+	})
+}
 
-				c.state.data[n01], c.state.data[n10] = c.state.data[n10], c.state.data[n01]
-			}
-		}(chunkidx[n], chunkidx[n+1])
+// Barrier records a barrier on qubits, which does nothing on the state.
+// Barriers separate instructions when drawing or optimizing the circuit.
+// If iregs is empty, barrier is placed on every qubit.
+func (c *Circuit) Barrier(iregs ...int) {
+	if len(iregs) == 0 {
+		iregs = slice.Range(0, c.Size())
 	}
 
-	wg.Wait()
+	if number.Min(iregs...) < 0 || number.Max(iregs...) >= c.Size() {
+		panic("Registers out of range.")
+	}
+
+	if slice.HasDuplicate(iregs) {
+		panic("Duplicate registers.")
+	}
+
+	c.exec(Instruction{Kind: KindBarrier, Targets: iregs})
 }
 
-// QFT applies QFT.
+// QFT applies QFT, where iregs[0] is the LSB.
+// Gates are recorded as usual, but applied at once by fast Fourier transform.
 func (c *Circuit) QFT(iregs ...int) {
+	regs := append([]int{}, iregs...)
+	c.fast(func() { c.qftGates(regs) }, func(c *Circuit) { c.state.qft(c, regs, false) })
+}
+
+// qftGates applies QFT gate by gate.
+func (c *Circuit) qftGates(iregs []int) {
 	phis := make([]float64, len(iregs))
 	for i := range phis {
 		phis[i] = math.Pi / float64(number.Pow(2, i))
@@ -823,27 +957,28 @@ func (c *Circuit) QFT(iregs ...int) {
 
 // InvQFT applies Inverse QFT.
 func (c *Circuit) InvQFT(iregs ...int) {
-	for i, j := 0, len(iregs)-1; i < j; i, j = i+1, j-1 {
-		c.Swap(iregs[i], iregs[j])
-	}
-
-	phis := make([]float64, len(iregs))
-
-	for i := range phis {
-		phis[i] = -math.Pi / float64(number.Pow(2, i))
-	}
-
-	for i := 0; i < len(iregs); i++ {
-		for j := 0; j < i; j++ {
-			c.Control(P(phis[i-j]), []int{iregs[j]}, []int{iregs[i]})
-		}
-		c.H(iregs[i])
-	}
+	regs := append([]int{}, iregs...)
+	c.fast(func() {
+		qft := NewRecorder(len(regs))
+		qft.QFT(slice.Range(0, len(regs))...)
+		c.Append(qft.Inverse(), regs)
+	}, func(c *Circuit) { c.state.qft(c, regs, true) })
 }
 
 // Measure measures qubits.
 func (c *Circuit) Measure(iregs ...int) int {
-	if number.Min(iregs...) < 0 || number.Max(iregs...) > c.Size() {
+	return c.MeasureTo(nil, iregs...)
+}
+
+// MeasureTo measures qubits, and stores the result to classical bits cregs.
+// cregs may be nil, in which case the result is not stored.
+// Returns -1 if the measurement was skipped by its condition.
+func (c *Circuit) MeasureTo(cregs []int, iregs ...int) int {
+	if len(iregs) == 0 {
+		panic("At least one input registers required.")
+	}
+
+	if number.Min(iregs...) < 0 || number.Max(iregs...) >= c.Size() {
 		panic("Register index out of range.")
 	}
 
@@ -851,9 +986,28 @@ func (c *Circuit) Measure(iregs ...int) int {
 		panic("Duplicate registers.")
 	}
 
+	if len(cregs) > 0 {
+		if len(cregs) != len(iregs) {
+			panic("Classical bits size does not match input registers.")
+		}
+
+		if number.Min(cregs...) < 0 || number.Max(cregs...) >= len(c.cbits) {
+			panic("Classical bits out of range.")
+		}
+
+		if slice.HasDuplicate(cregs) {
+			panic("Duplicate classical bits.")
+		}
+	}
+
+	return c.exec(Instruction{Kind: KindMeasure, Targets: iregs, Cbits: cregs})
+}
+
+// measure measures qubits of the state, and stores the result to cregs.
+func (v *vector[T]) measure(c *Circuit, iregs, cregs []int) int {
 	probs := make([]float64, 1<<len(iregs))
 
-	for n, amp := range c.state.data {
+	for n, amp := range v.data {
 		if amp == 0 {
 			continue
 		}
@@ -861,7 +1015,8 @@ func (c *Circuit) Measure(iregs ...int) int {
 		for i, q := range iregs {
 			o += ((n >> q) & 1) << i
 		}
-		probs[o] += real(amp)*real(amp) + imag(amp)*imag(amp)
+		a := complex128(amp)
+		probs[o] += real(a)*real(a) + imag(a)*imag(a)
 	}
 
 	rand := rand.Float64()
@@ -878,7 +1033,7 @@ func (c *Circuit) Measure(iregs ...int) int {
 
 	s := complex(math.Sqrt(probs[output]), 0)
 
-	for n, amp := range c.state.data {
+	for n, amp := range v.data {
 		if amp == 0 {
 			continue
 		}
@@ -886,19 +1041,55 @@ func (c *Circuit) Measure(iregs ...int) int {
 		has_output := true
 		for i, q := range iregs {
 			if (n>>q)&1 != (output>>i)&1 {
-				c.state.data[n] = 0
+				v.data[n] = 0
 				has_output = false
 			}
 		}
 		if has_output {
-			c.state.data[n] /= s
+			v.data[n] /= T(s)
 		}
 	}
 
+	for i, b := range cregs {
+		c.cbits[b] = (output >> i) & 1
+	}
+
 	return output
 }
 
+// Reset resets qubits to |0>, by measuring and flipping them.
+func (c *Circuit) Reset(iregs ...int) {
+	if len(iregs) == 0 {
+		panic("At least one input registers required.")
+	}
+
+	if number.Min(iregs...) < 0 || number.Max(iregs...) >= c.Size() {
+		panic("Register index out of range.")
+	}
+
+	if slice.HasDuplicate(iregs) {
+		panic("Duplicate registers.")
+	}
+
+	c.exec(Instruction{Kind: KindReset, Targets: iregs})
+}
+
+// reset resets qubits of the state to |0>.
+func (c *Circuit) reset(iregs []int) {
+	output := c.state.measure(c, iregs, nil)
+	for i, q := range iregs {
+		if (output>>i)&1 == 1 {
+			c.state.applyGate(c, X(), []int{q})
+		}
+	}
+}
+
 // String implements the Stringer interface.
-func (q Circuit) String() string {
-	return q.state.String()
+// If the circuit has classical registers, their values are appended.
+func (q *Circuit) String() string {
+	if len(q.cregs) == 0 {
+		return q.State().String()
+	}
+
+	return q.State().String() + q.formatValues() + "\n"
 }
@@ -2,10 +2,13 @@ package qsim_test
 
 import (
 	"math"
+	"math/cmplx"
 	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
 	"github.com/sp301415/qsim/math/vec"
 	"github.com/sp301415/qsim/utils/slice"
 )
@@ -146,6 +149,76 @@ func TestOracle(t *testing.T) {
 	}
 }
 
+func TestPhaseOracle(t *testing.T) {
+	N := 4
+	iregs := slice.Range(0, N)
+	f := func(x int) bool { return x == 5 || x == 12 }
+
+	c1 := qsim.NewCircuit(N)
+	c1.H(iregs...)
+	c1.ApplyPhaseOracle(f, iregs...)
+
+	// Phase kickback with |-> ancilla.
+	c2 := qsim.NewCircuit(N + 1)
+	c2.X(N)
+	c2.H(N)
+	c2.H(iregs...)
+	c2.ApplyOracle(func(x int) int {
+		if f(x) {
+			return 1
+		}
+		return 0
+	}, iregs, []int{N})
+	c2.H(N)
+	c2.X(N)
+
+	q := c2.State().ToVec()[:1<<N]
+	if !c1.State().Equals(qsim.NewQubit(q)) {
+		t.Fail()
+	}
+}
+
+func TestCheckOracle(t *testing.T) {
+	c := qsim.NewCircuit(3)
+	c.Option.CHECK_ORACLE = true
+	c.H(0, 1, 2)
+
+	// Valid oracle should pass, calling the oracle once per basis state.
+	calls := 0
+	c.ApplyOracle(func(x int) int { calls++; return x & 1 }, []int{0, 1}, []int{2})
+	if calls != 8 {
+		t.Fatal(calls)
+	}
+
+	// Errors are returned without changing the state.
+	q := c.State()
+	if c.CheckOracle(func(x int) int { return x & 1 }, []int{0, 1}, []int{2}) != nil {
+		t.Fail()
+	}
+	if c.CheckOracle(func(x int) int { return 2 }, []int{0, 1}, []int{2}) == nil {
+		t.Fail()
+	}
+	if !c.State().Equals(q) {
+		t.Fail()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fail()
+		}
+	}()
+
+	// Stateful oracle gives collisions.
+	cnt := 0
+	c.ApplyOracle(func(x int) int {
+		cnt++
+		if cnt > 4 {
+			return 1
+		}
+		return 0
+	}, []int{0, 1}, []int{2})
+}
+
 func TestSingleCX(t *testing.T) {
 	c := qsim.NewCircuit(2)
 	c.X(0)
@@ -212,6 +285,105 @@ func TestCHH(t *testing.T) {
 	}
 }
 
+func TestControlGeneral(t *testing.T) {
+	c := qsim.NewCircuit(4)
+
+	c.H(0)
+	c.Control(qsim.X().Tensor(qsim.X()).Tensor(qsim.X()), []int{0}, []int{1, 2, 3})
+
+	q := vec.NewVec(1 << 4)
+	q[0b0000] = math.Sqrt2 / 2.0
+	q[0b1111] = math.Sqrt2 / 2.0
+
+	if !c.State().Equals(qsim.NewQubit(q)) {
+		t.Fail()
+	}
+}
+
+func TestRotation(t *testing.T) {
+	theta := 0.7
+
+	c1 := qsim.NewCircuit(1)
+	c1.H(0)
+	c1.RZ(theta, 0)
+
+	c2 := qsim.NewCircuit(1)
+	c2.H(0)
+	c2.P(theta, 0)
+
+	// RZ(theta) = exp(-i theta/2) P(theta).
+	q := c2.State().ToVec().ScalarMul(cmplx.Rect(1, -theta/2))
+	if !c1.State().Equals(qsim.NewQubit(q)) {
+		t.Fail()
+	}
+
+	// RX(pi) = -iX, RY(pi) = -iY, so RY(pi)RX(pi) = -YX = iZ.
+	c3 := qsim.NewCircuit(1)
+	c3.RX(math.Pi, 0)
+	c3.RY(math.Pi, 0)
+
+	if !c3.State().Equals(qsim.NewQubit(vec.NewVecVars(1i, 0))) {
+		t.Fail()
+	}
+}
+
+func TestGateCopy(t *testing.T) {
+	g := qsim.H().Copy()
+	if g.Size() != 1 {
+		t.Fatal()
+	}
+
+	c1 := qsim.NewCircuit(1)
+	c1.Apply(g, 0)
+
+	c2 := qsim.NewCircuit(1)
+	c2.H(0)
+
+	if !c1.State().Equals(c2.State()) {
+		t.Fail()
+	}
+}
+
+func TestNamedGateDagger(t *testing.T) {
+	// Named gates have no params, so they should fall back to the conjugate transpose.
+	for _, name := range []string{"P", "RX", "RY", "RZ", "U3"} {
+		g := qsim.NewNamedGate(name, qsim.RX(0.3).ToMat())
+		if !g.Dagger().Equals(qsim.RX(-0.3)) {
+			t.Fail()
+		}
+	}
+}
+
+func TestU3(t *testing.T) {
+	theta, phi, lambda := 0.3, 1.2, -0.7
+
+	c := qsim.NewCircuit(1)
+	c.RZ(lambda, 0)
+	c.RY(theta, 0)
+	c.RZ(phi, 0)
+
+	// U3(t, p, l) = exp(i(p+l)/2) RZ(p) RY(t) RZ(l).
+	U := c.Unitary(false).ScalarMul(cmplx.Rect(1, (phi+lambda)/2))
+	if !qsim.U3(theta, phi, lambda).ToMat().Equals(U) {
+		t.Fail()
+	}
+
+	g := qsim.U3(theta, phi, lambda)
+	if !g.Dagger().Equals(qsim.U3(g.Dagger().Params()[0], g.Dagger().Params()[1], g.Dagger().Params()[2])) {
+		t.Fail()
+	}
+}
+
+func TestSX(t *testing.T) {
+	c := qsim.NewCircuit(1)
+	c.SX(0)
+	c.SX(0)
+
+	if !c.Unitary(false).Equals(qsim.X().ToMat()) || qsim.SX().Dagger().Name() != "SXdg" {
+		t.Fail()
+	}
+}
+
 func TestEntangle(t *testing.T) {
 	N := 10
 	c := qsim.NewCircuit(N)
@@ -300,6 +472,754 @@ func TestParallel(t *testing.T) {
 	}
 }
 
+func TestReversedApply(t *testing.T) {
+	XI := qsim.X().Tensor(qsim.I())
+
+	for _, thr := range []int{0, 10} {
+		c1 := qsim.NewCircuit(3)
+		c2 := qsim.NewCircuit(3)
+		c1.Option.PARALLEL_THRESHOLD = thr
+		c2.Option.PARALLEL_THRESHOLD = thr
+
+		c1.X(0)
+		c2.Apply(XI, 1, 0)
+		c2.Apply(XI, 1, 0)
+		c2.Apply(XI, 1, 0)
+
+		c1.Control(qsim.X(), []int{2}, []int{1})
+		c2.Control(XI, []int{2}, []int{0, 1})
+
+		if !c1.State().Equals(c2.State()) {
+			t.Fail()
+		}
+	}
+}
+
+func TestReservedNames(t *testing.T) {
+	// Gates are applied by their matrices, even if they reuse the names of famous gates.
+	for _, thr := range []int{0, 10} {
+		c := qsim.NewCircuit(3)
+		c.Option.PARALLEL_THRESHOLD = thr
+		c.Apply(qsim.NewNamedGate("I", qsim.X().ToMat()), 0)
+		c.Apply(qsim.NewNamedGate("SWAP", qsim.I().Tensor(qsim.I()).ToMat()), 0, 1)
+		c.Control(qsim.NewNamedGate("I", qsim.X().ToMat()), []int{0}, []int{2})
+
+		if !c.State().Equals(qsim.NewBit(0b101, 3)) {
+			t.Fatal(thr)
+		}
+	}
+
+	c := qsim.NewRecorder(2)
+	c.Apply(qsim.NewNamedGate("SWAP", qsim.I().Tensor(qsim.I()).ToMat()), 0, 1)
+	c.Control(qsim.NewNamedGate("I", qsim.X().ToMat()), []int{0}, []int{1})
+	if c.Metrics().CXCount == 0 || strings.Contains(c.Draw(), "x") {
+		t.Fail()
+	}
+}
+
+func TestNoRecord(t *testing.T) {
+	c1 := qsim.NewCircuit(4)
+	c1.Option.NO_RECORD = true
+	c2 := qsim.NewCircuit(4)
+
+	for _, c := range []*qsim.Circuit{c1, c2} {
+		c.H(0, 1, 2, 3)
+		c.CX(0, 1)
+		c.QFT(0, 1, 2, 3)
+		c.T(2)
+	}
+
+	if len(c1.Instructions()) != 0 || len(c2.Instructions()) == 0 {
+		t.Fail()
+	}
+
+	if !c1.State().Equals(c2.State()) {
+		t.Fail()
+	}
+}
+
+func TestTeleport(t *testing.T) {
+	theta := rand.Float64() * math.Pi
+
+	for i := 0; i < 10; i++ {
+		c := qsim.NewCircuit(3)
+		m := c.AddCbits(2)
+
+		c.RY(theta, 0)
+		c.H(1)
+		c.CX(1, 2)
+
+		c.CX(0, 1)
+		c.H(0)
+		c.MeasureTo(m, 0, 1)
+
+		c.CIf(m[1:], 1, func() { c.X(2) })
+		c.CIf(m[:1], 1, func() { c.Z(2) })
+
+		// Qubits 0 and 1 are collapsed to the measured value.
+		v := c.CbitsValue(m...)
+		q := vec.NewVec(1 << 3)
+		q[v] = complex(math.Cos(theta/2), 0)
+		q[v|0b100] = complex(math.Sin(theta/2), 0)
+
+		if !c.State().Equals(qsim.NewQubit(q)) {
+			t.Fail()
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	c := qsim.NewCircuit(2)
+
+	c.H(0)
+	c.CX(0, 1)
+	c.Reset(0, 1)
+
+	if !c.State().Equals(qsim.NewBit(0, 2)) {
+		t.Fail()
+	}
+}
+
+func TestRun(t *testing.T) {
+	c := qsim.NewCircuit(3)
+	c.SetBit(0b001)
+
+	c.CX(0, 1)
+	c.Swap(1, 2)
+	c.P(math.Pi/2, 2)
+
+	if len(c.Instructions()) != 3 || c.Instructions()[0].Name() != "CX" {
+		t.Fail()
+	}
+
+	s := c.State()
+	c.Run()
+
+	if !c.State().Equals(s) {
+		t.Fail()
+	}
+}
+
+func TestCounts(t *testing.T) {
+	c := qsim.NewCircuit(2)
+	m := c.AddCbits(2)
+
+	c.H(0)
+	c.CX(0, 1)
+	c.MeasureTo(m, 0, 1)
+
+	counts := c.Counts(100)
+	if counts[0b00]+counts[0b11] != 100 {
+		t.Fail()
+	}
+
+	// Conditioned on the first result, second shot always flips to 0.
+	c.CIf(m[:1], 1, func() { c.X(0, 1) })
+	c.MeasureTo(m, 0, 1)
+
+	if c.Counts(100)[0] != 100 {
+		t.Fail()
+	}
+}
+
+func TestRegister(t *testing.T) {
+	c := qsim.NewCircuit(0)
+	a := c.AddRegister("a", 2)
+	c.X(a[0])
+
+	// Adding registers keeps the previous state.
+	b := c.AddRegister("b", 1)
+	if c.Size() != 3 || b[0] != 2 || !c.State().Equals(qsim.NewBit(0b001, 3)) {
+		t.Fail()
+	}
+
+	m := c.AddClassicalRegister("m", 2)
+	n := c.AddClassicalRegister("n", 1)
+	c.CX(a[0], b[0])
+	c.MeasureTo(m, a...)
+	c.MeasureTo(n, b...)
+
+	if c.Register("b")[0] != b[0] || c.Value(m) != 0b01 || c.Values()["n"] != 1 {
+		t.Fail()
+	}
+
+	if !strings.HasSuffix(c.String(), "m=01 n=1\n") {
+		t.Fail()
+	}
+
+	if c.RegisterCounts(10)["m=01 n=1"] != 10 {
+		t.Fail()
+	}
+}
+
+func TestDraw(t *testing.T) {
+	c := qsim.NewCircuit(3)
+	m := c.AddCbits(1)
+
+	c.H(0)
+	c.CX(0, 2)
+	c.X(1)
+	c.Barrier()
+	c.MeasureTo(m, 0)
+	c.CIf(m, 1, func() { c.Z(1) })
+
+	want := "" +
+		"q[0]: -[H]--*------|-[M>c0]----------------\n" +
+		"            |      |\n" +
+		"q[1]: ------+--[X]-|---------[Z if c[0]=1]-\n" +
+		"            |      |\n" +
+		"q[2]: -----[X]-----|-----------------------\n"
+
+	if c.Draw() != want {
+		t.Fail()
+	}
+}
+
+func TestQuantikz(t *testing.T) {
+	c := qsim.NewCircuit(3)
+	m := c.AddCbits(1)
+
+	c.H(0)
+	c.CX(0, 2)
+	c.Apply(qsim.S().Dagger().Tensor(qsim.RZ(0.5)), 1, 2)
+	c.ApplyOracle(func(x int) int { return x }, []int{0}, []int{2})
+	c.MeasureTo(m, 0)
+
+	want := "" +
+		"\\begin{quantikz}\n" +
+		"\\lstick{$q_{0}$} & \\gate{H} & \\ctrl{2} & \\qw & \\gate{{U_f}_{0}} \\vqw{2} & \\meter{} & \\qw \\\\\n" +
+		"\\lstick{$q_{1}$} & \\qw & \\qw & \\gate[2]{S^\\dagger \\otimes R_Z} & \\qw & \\qw & \\qw \\\\\n" +
+		"\\lstick{$q_{2}$} & \\qw & \\targ{} &  & \\gate{{U_f}_{1}} & \\qw & \\qw\n" +
+		"\\end{quantikz}\n"
+
+	if c.Quantikz() != want {
+		t.Log("\n" + c.Quantikz())
+		t.Fail()
+	}
+}
+
+func TestQuantikzEscape(t *testing.T) {
+	c := qsim.NewCircuit(0)
+	r := c.AddRegister("a_b&c", 2)
+	m := c.AddCbits(1)
+
+	c.Apply(qsim.NewNamedGate("my_U", qsim.X().ToMat()), r[0])
+	c.MeasureTo(m, r[0])
+	c.CIf(m, 1, func() { c.Measure(r[1]) })
+
+	want := "" +
+		"\\begin{quantikz}\n" +
+		"\\lstick{$a\\_b\\&c_{0}$} & \\gate{my\\_U} & \\meter{} & \\qw & \\qw \\\\\n" +
+		"\\lstick{$a\\_b\\&c_{1}$} & \\qw & \\qw & \\meter{\\text{ if } c_{0}=1} & \\qw\n" +
+		"\\end{quantikz}\n"
+
+	if c.Quantikz() != want {
+		t.Log("\n" + c.Quantikz())
+		t.Fail()
+	}
+}
+
+func TestSVG(t *testing.T) {
+	c := qsim.NewCircuit(2)
+	c.H(0)
+	c.CX(0, 1)
+	c.Swap(0, 1)
+	c.Measure(0, 1)
+
+	svg := c.SVG()
+	if !strings.HasPrefix(svg, "<svg") || strings.Count(svg, "<rect") != 4 || strings.Count(svg, "<circle") != 2 {
+		t.Fail()
+	}
+}
+
+func TestUnitary(t *testing.T) {
+	c := qsim.NewCircuit(2)
+	c.H(0)
+	c.CX(0, 1)
+
+	// Columns are the images of |00>, |01>, |10>, |11>.
+	r := complex(math.Sqrt2/2, 0)
+	U := mat.NewMatVars(4,
+		r, r, 0, 0,
+		0, 0, r, -r,
+		0, 0, r, r,
+		r, -r, 0, 0,
+	)
+
+	if !c.Unitary(false).Equals(U) {
+		t.Fail()
+	}
+
+	// RZ equals P up to global phase.
+	c1 := qsim.NewCircuit(1)
+	c1.RZ(0.3, 0)
+	if !c1.Unitary(true).Equals(qsim.P(0.3).ToMat()) {
+		t.Fail()
+	}
+}
+
+func TestToGate(t *testing.T) {
+	sub := qsim.NewCircuit(3)
+	sub.H(0)
+	sub.CCX(0, 1, 2)
+	sub.Swap(0, 2)
+	sub.T(1)
+	g := sub.ToGate()
+
+	c1 := qsim.NewCircuit(4)
+	c2 := qsim.NewCircuit(4)
+	c1.H(0, 1, 2, 3)
+	c2.H(0, 1, 2, 3)
+
+	c1.Apply(g, 3, 1, 0)
+	c2.H(3)
+	c2.CCX(3, 1, 0)
+	c2.Swap(3, 0)
+	c2.T(1)
+
+	if !c1.State().Equals(c2.State()) {
+		t.Fail()
+	}
+}
+
+func TestInverse(t *testing.T) {
+	N := 4
+	regs := slice.Range(0, N)
+
+	sub := qsim.NewCircuit(N)
+	sub.H(regs...)
+	sub.T(0)
+	sub.RY(0.4, 1)
+	sub.CCX(0, 1, 2)
+	sub.Control(qsim.S(), []int{2}, []int{3})
+	sub.ApplyOracle(func(x int) int { return x * 3 }, []int{0, 1}, []int{2, 3})
+	sub.ApplyPhaseOracle(func(x int) bool { return x == 5 }, regs...)
+
+	c := qsim.NewCircuit(N)
+	c.SetBit(0b1010)
+	c.Append(sub, nil)
+	c.Append(sub.Inverse(), nil)
+
+	if !c.State().Equals(qsim.NewBit(0b1010, N)) {
+		t.Fail()
+	}
+
+	if sub.Inverse().Instructions()[2].Name() != "CSdg" {
+		t.Fail()
+	}
+}
+
+func TestPower(t *testing.T) {
+	c := qsim.NewCircuit(1)
+	c.T(0)
+
+	if !c.Power(4).Unitary(false).Equals(qsim.Z().ToMat()) {
+		t.Fail()
+	}
+
+	if !c.Power(-2).Unitary(false).Equals(qsim.S().Dagger().ToMat()) {
+		t.Fail()
+	}
+}
+
+func TestControlled(t *testing.T) {
+	sub := qsim.NewCircuit(3)
+	sub.H(0)
+	sub.CX(0, 1)
+	sub.ApplyOracle(func(x int) int { return x ^ 1 }, []int{0}, []int{1})
+	sub.ApplyPhaseOracle(func(x int) bool { return x == 1 }, 1)
+
+	csub := sub.Controlled([]int{2})
+	for _, v := range []int{0b000, 0b100} {
+		c1 := qsim.NewCircuit(3)
+		c1.SetBit(v)
+		c1.Append(csub, nil)
+
+		c2 := qsim.NewCircuit(3)
+		c2.SetBit(v)
+		if v == 0b100 {
+			c2.Append(sub, nil)
+		}
+
+		if !c1.State().Equals(c2.State()) {
+			t.Fail()
+		}
+	}
+}
+
+func TestAppend(t *testing.T) {
+	sub := qsim.NewCircuit(2)
+	sub.X(0)
+	sub.CX(0, 1)
+
+	c := qsim.NewCircuit(3)
+	c.Append(sub, []int{2, 0})
+
+	if !c.State().Equals(qsim.NewBit(0b101, 3)) {
+		t.Fail()
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	c := qsim.NewCircuit(4)
+	c.H(0)
+	c.T(1)
+	c.CX(0, 1)
+	c.T(1)
+	c.T(2)
+	c.Barrier()
+	c.CCX(0, 1, 3)
+	c.Swap(2, 3)
+	c.Measure(2)
+
+	m := c.Metrics()
+	if m.Size != 8 || m.Depth != 6 || m.Qubits != 4 || m.TwoQubit != 2 {
+		t.Fatal(m)
+	}
+
+	if m.TCount != 3 || m.TDepth != 2 || m.CXCount != 1+6+3 {
+		t.Fatal(m)
+	}
+
+	if m.Counts["T"] != 3 || m.Counts["CCX"] != 1 || m.Counts["Measure"] != 1 {
+		t.Fatal(m.Counts)
+	}
+
+	moments := c.Moments()
+	if len(moments[0]) != 3 || len(moments[1]) != 1 {
+		t.Fail()
+	}
+
+	path := c.CriticalPath()
+	if len(path) != m.Depth || path[0].Name() != "H" || path[len(path)-1].Name() != "Measure" {
+		t.Fail()
+	}
+}
+
+func TestFusion(t *testing.T) {
+	build := func(k int) *qsim.Circuit {
+		c := qsim.NewCircuit(4)
+		c.Option.FUSION_QUBITS = k
+		c.AddCbits(1)
+
+		c.H(0, 1, 2, 3)
+		c.CX(0, 1)
+		c.RY(0.3, 1)
+		c.Control(qsim.P(0.7), []int{2}, []int{0})
+		c.Swap(1, 3)
+		c.CCX(0, 1, 2)
+		c.U3(0.1, 0.2, 0.3, 3)
+		c.QFT(0, 1, 2, 3)
+		c.MeasureTo([]int{0}, 0)
+		c.CIf([]int{0}, 1, func() { c.X(1) })
+		c.T(1, 2)
+		return c
+	}
+
+	rand.Seed(1)
+	want := build(0)
+	for k := 1; k <= 4; k++ {
+		rand.Seed(1)
+		c := build(k)
+		if !c.State().Equals(want.State()) {
+			t.Fatalf("%d", k)
+		}
+
+		plan := c.Plan()
+		if k > 1 && len(plan) >= len(c.Instructions()) {
+			t.Fatalf("%d: %d", k, len(plan))
+		}
+
+		rand.Seed(1)
+		c.Run()
+		rand.Seed(1)
+		want.Run()
+		if !c.State().Equals(want.State()) {
+			t.Fatalf("Run %d", k)
+		}
+	}
+
+	u := qsim.NewCircuit(3)
+	u.H(0, 1)
+	u.CX(0, 2)
+	u.RZ(0.4, 2)
+	want = u
+	fused := u.Inverse().Inverse()
+	fused.Option.FUSION_QUBITS = 3
+	if len(fused.Plan()) != 1 || !fused.Unitary(false).Equals(want.Unitary(false)) {
+		t.Fail()
+	}
+}
+
+func TestWorkerPool(t *testing.T) {
+	build := func(c *qsim.Circuit) {
+		c.H(0, 1, 2, 3, 4)
+		c.CX(0, 3)
+		c.Control(qsim.RY(0.3), []int{4}, []int{1})
+		c.Control(qsim.RX(0.5).Tensor(qsim.S()), []int{0, 2}, []int{1, 3})
+		c.Swap(1, 4)
+		c.U3(0.1, 0.2, 0.3, 2)
+		c.Apply(qsim.H().Tensor(qsim.T()), 3, 0)
+		c.QFT(0, 1, 2, 3, 4)
+	}
+
+	want := qsim.NewCircuit(5)
+	want.Option.GOROUTINE_CNT = 1
+	build(want)
+
+	for _, cnt := range []int{2, 3, 8} {
+		c := qsim.NewCircuit(5)
+		c.Option.PARALLEL_THRESHOLD = 0
+		c.Option.GOROUTINE_CNT = cnt
+		build(c)
+		if !c.State().Equals(want.State()) {
+			t.Fatalf("%d", cnt)
+		}
+
+		// Circuit is still usable after Close.
+		c.Close()
+		c.Run()
+		if !c.State().Equals(want.State()) {
+			t.Fatalf("Close %d", cnt)
+		}
+		c.Close()
+	}
+}
+
+// applyReference applies op controlled by ctrls to targets of v, by the definition.
+func applyReference(v vec.Vec, op qsim.Gate, ctrls, targets []int) vec.Vec {
+	r := vec.NewVec(len(v))
+	for x, amp := range v {
+		set := true
+		for _, q := range ctrls {
+			set = set && x>>q&1 == 1
+		}
+		if !set {
+			r[x] += amp
+			continue
+		}
+
+		tx := 0
+		for i, q := range targets {
+			tx |= (x >> q & 1) << i
+		}
+		for ty := 0; ty < 1<<len(targets); ty++ {
+			y := x
+			for i, q := range targets {
+				y = y&^(1<<q) | (ty>>i&1)<<q
+			}
+			r[y] += op.At(ty, tx) * amp
+		}
+	}
+
+	return r
+}
+
+func TestKernels(t *testing.T) {
+	cases := []struct {
+		op      qsim.Gate
+		ctrls   []int
+		targets []int
+	}{
+		{qsim.X(), nil, []int{2}},
+		{qsim.Y(), nil, []int{0}},
+		{qsim.Z(), nil, []int{4}},
+		{qsim.T(), []int{1}, []int{3}},
+		{qsim.P(0.3), []int{0, 4}, []int{2}},
+		{qsim.X(), []int{3, 1}, []int{0}},
+		{qsim.Y().Tensor(qsim.X()), []int{2}, []int{4, 0}},
+		{qsim.SWAP(), []int{1}, []int{0, 3}},
+		{qsim.S().Tensor(qsim.RZ(0.4)), nil, []int{3, 1}},
+		{qsim.RY(0.7), []int{4}, []int{1}},
+		{qsim.H().Tensor(qsim.U3(0.1, 0.2, 0.3)), []int{0}, []int{4, 2}},
+		{qsim.H().Tensor(qsim.H()).Tensor(qsim.T()), []int{1}, []int{0, 4, 2}},
+		{qsim.X().Tensor(qsim.Z()).Tensor(qsim.S()), []int{3}, []int{0, 4, 2}},
+	}
+
+	for _, thr := range []int{0, 10} {
+		for i, cs := range cases {
+			c := qsim.NewCircuit(5)
+			c.Option.PARALLEL_THRESHOLD = thr
+			c.Option.GOROUTINE_CNT = 3
+			for q := 0; q < 5; q++ {
+				c.U3(0.3*float64(q+1), 0.5*float64(q), 0.7, q)
+			}
+
+			want := applyReference(c.State().ToVec(), cs.op, cs.ctrls, cs.targets)
+			c.Control(cs.op, cs.ctrls, cs.targets)
+			if !c.State().ToVec().Equals(want) {
+				t.Fatalf("%d, %d", thr, i)
+			}
+			c.Close()
+		}
+	}
+}
+
+func TestFastKernels(t *testing.T) {
+	N := 6
+	prepare := func(c *qsim.Circuit) {
+		for q := 0; q < N; q++ {
+			c.U3(0.3*float64(q+1), 0.5*float64(q), 0.7, q)
+		}
+		c.CX(0, 3)
+	}
+
+	for _, thr := range []int{0, 10} {
+		c := qsim.NewCircuit(N)
+		c.Option.PARALLEL_THRESHOLD = thr
+		c.Option.GOROUTINE_CNT = 3
+		prepare(c)
+		c.H(4, 1, 2)
+		c.QFT(5, 0, 2, 3)
+		c.RX(0.2, 1)
+		c.InvQFT(1, 4)
+		c.QFT()
+		c.H(0, 1)
+		c.QFT(0, 1, 2)
+
+		// Gate by gate execution of the same instructions.
+		want := qsim.NewCircuit(N).Rebuild(c.Instructions())
+		if !c.State().Equals(want.State()) {
+			t.Fatalf("%d", thr)
+		}
+
+		c.Run()
+		if !c.State().Equals(want.State()) {
+			t.Fatalf("Run %d", thr)
+		}
+		c.Close()
+	}
+
+	// Fast kernels are not used inside CIf.
+	c := qsim.NewCircuit(2)
+	c.AddCbits(1)
+	c.CIf([]int{0}, 1, func() { c.H(0, 1) })
+	c.CIf([]int{0}, 0, func() { c.QFT(0, 1) })
+	if !c.State().Equals(qsim.NewQubit(vec.NewVecSlice([]complex128{0.5, 0.5, 0.5, 0.5}))) {
+		t.Fail()
+	}
+}
+
+func TestSinglePrecision(t *testing.T) {
+	N := 10
+	regs := slice.Range(0, N)
+
+	circuits := map[string]func(c *qsim.Circuit){
+		"QFT": func(c *qsim.Circuit) {
+			for q := 0; q < N; q++ {
+				c.U3(0.3*float64(q+1), 0.5*float64(q), 0.7, q)
+			}
+			c.QFT(regs...)
+		},
+		"Grover": func(c *qsim.Circuit) {
+			c.H(regs...)
+			for j := 0; j < 25; j++ {
+				c.ApplyPhaseOracle(func(x int) bool { return x == 123 }, regs...)
+				c.H(regs...)
+				c.X(regs...)
+				c.Control(qsim.Z(), regs[1:], regs[:1])
+				c.X(regs...)
+				c.H(regs...)
+			}
+		},
+		"Random": func(c *qsim.Circuit) {
+			r := rand.New(rand.NewSource(1))
+			for j := 0; j < 1000; j++ {
+				q0, q1 := r.Intn(N), r.Intn(N-1)
+				if q1 >= q0 {
+					q1++
+				}
+				c.U3(r.Float64()*math.Pi, r.Float64()*math.Pi, r.Float64()*math.Pi, q0)
+				c.CX(q0, q1)
+				c.Control(qsim.RY(r.Float64()), []int{q1}, []int{q0})
+			}
+		},
+	}
+
+	for name, build := range circuits {
+		want := qsim.NewCircuit(N)
+		build(want)
+
+		opt := qsim.DefaultOptions()
+		opt.SINGLE_PRECISION = true
+		c := qsim.NewCircuitWithOptions(N, opt)
+		build(c)
+
+		// Error grows like sqrt(g) * 2^-24 for g gates.
+		if d := c.State().ToVec().Sub(want.State().ToVec()).Norm(); d > 1e-5 {
+			t.Fatalf("%s: %v", name, d)
+		}
+
+		c.Run()
+		if d := c.State().ToVec().Sub(want.State().ToVec()).Norm(); d > 1e-5 {
+			t.Fatalf("Run %s: %v", name, d)
+		}
+	}
+
+	// Registers and measurements in single precision.
+	opt := qsim.DefaultOptions()
+	opt.SINGLE_PRECISION = true
+	c := qsim.NewCircuitWithOptions(1, opt)
+	c.X(0)
+	r := c.AddRegister("r", 2)
+	c.CCX(0, r[0], r[1])
+	c.CX(0, r[0])
+	if c.Measure(0, 1, 2) != 0b011 {
+		t.Fail()
+	}
+}
+
+func TestMemory(t *testing.T) {
+	opt := qsim.DefaultOptions()
+	if opt.EstimateMemory(20) != 32<<20 || qsim.EstimateMemory(20) != 32<<20 {
+		t.Fail()
+	}
+
+	opt.SINGLE_PRECISION = true
+	opt.LAZY_TEMP = true
+	if opt.EstimateMemory(30) != 8<<30 {
+		t.Fail()
+	}
+
+	// Without temp buffer until oracles or large gates need it.
+	opt = qsim.DefaultOptions()
+	opt.LAZY_TEMP = true
+	for _, thr := range []int{0, 10} {
+		opt.PARALLEL_THRESHOLD = thr
+		c := qsim.NewCircuitWithOptions(4, opt)
+		want := qsim.NewCircuit(4)
+		for _, d := range []*qsim.Circuit{c, want} {
+			d.H(0, 1)
+			d.AddRegister("r", 4)
+			d.ApplyOracle(func(x int) int { return x + 1 }, []int{0, 1}, []int{2, 3, 4})
+			d.Control(qsim.RX(0.3).Tensor(qsim.H()).Tensor(qsim.H()).Tensor(qsim.S()).Tensor(qsim.T()).Tensor(qsim.X()).Tensor(qsim.Y()), []int{4}, []int{0, 1, 2, 3, 5, 6, 7})
+		}
+		if !c.State().Equals(want.State()) {
+			t.Fatalf("%d", thr)
+		}
+		c.Close()
+	}
+
+	opt = qsim.DefaultOptions()
+	opt.MAX_QUBITS = 3
+	c := qsim.NewCircuitWithOptions(2, opt)
+	for _, f := range []func(){
+		func() { qsim.NewCircuitWithOptions(4, opt) },
+		func() { c.AddRegister("r", 2) },
+		func() { qsim.NewCircuitWithOptions(2, qsim.Options{MAX_QUBITS: 64}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fail()
+				}
+			}()
+			f()
+		}()
+	}
+	c.AddRegister("r", 1)
+}
+
 func BenchmarkTensorApply(b *testing.B) {
 	N := 10
 	regs := slice.Range(0, N)
@@ -384,3 +1304,183 @@ func BenchmarkApplyParallelLarge(b *testing.B) {
 		c.T(regs...)
 	}
 }
+
+// benchmarkQFT applies QFT to 20 qubits, and reports the number of state sweeps.
+func benchmarkQFT(b *testing.B, k int) {
+	N := 20
+	regs := slice.Range(0, N)
+
+	for i := 0; i < b.N; i++ {
+		c := qsim.NewCircuit(N)
+		c.Option.FUSION_QUBITS = k
+
+		c.H(regs...)
+		c.QFT(regs...)
+		c.State()
+
+		b.ReportMetric(float64(len(c.Plan())), "sweeps/op")
+	}
+}
+
+func BenchmarkQFT(b *testing.B) {
+	benchmarkQFT(b, 0)
+}
+
+func BenchmarkQFTFused(b *testing.B) {
+	benchmarkQFT(b, 3)
+}
+
+// benchmarkGrover runs Grover search on 18 qubits, and reports the number of state sweeps.
+func benchmarkGrover(b *testing.B, k int) {
+	N := 18
+	regs := slice.Range(0, N)
+	target := 12345
+
+	for i := 0; i < b.N; i++ {
+		c := qsim.NewCircuit(N)
+		c.Option.FUSION_QUBITS = k
+
+		c.H(regs...)
+		for j := 0; j < 8; j++ {
+			c.ApplyPhaseOracle(func(x int) bool { return x == target }, regs...)
+			c.H(regs...)
+			c.X(regs...)
+			c.Control(qsim.Z(), regs[1:], regs[:1])
+			c.X(regs...)
+			c.H(regs...)
+		}
+		c.State()
+
+		b.ReportMetric(float64(len(c.Plan())), "sweeps/op")
+	}
+}
+
+func BenchmarkGrover(b *testing.B) {
+	benchmarkGrover(b, 0)
+}
+
+func BenchmarkGroverFused(b *testing.B) {
+	benchmarkGrover(b, 2)
+}
+
+// benchmarkGates applies the instructions built by build on n qubits gate by gate, with FUSION_QUBITS = k,
+// and reports the number of state sweeps. Unlike calling build directly, fast kernels such as FFT are not used.
+func benchmarkGates(b *testing.B, n int, build func(c *qsim.Circuit), k int) {
+	rec := qsim.NewRecorder(n)
+	build(rec)
+	insts := rec.Instructions()
+
+	for i := 0; i < b.N; i++ {
+		c := qsim.NewCircuit(n)
+		c.Option.FUSION_QUBITS = k
+		c = c.Rebuild(insts)
+		c.State()
+
+		b.ReportMetric(float64(len(c.Plan())), "sweeps/op")
+	}
+}
+
+// qft applies H and QFT to every qubit.
+func qft(c *qsim.Circuit) {
+	regs := slice.Range(0, c.Size())
+	c.H(regs...)
+	c.QFT(regs...)
+}
+
+func BenchmarkQFTGates(b *testing.B) {
+	benchmarkGates(b, 20, qft, 0)
+}
+
+func BenchmarkQFTGatesFused(b *testing.B) {
+	benchmarkGates(b, 20, qft, 3)
+}
+
+// grover runs 8 iterations of Grover search on every qubit.
+func grover(c *qsim.Circuit) {
+	regs := slice.Range(0, c.Size())
+	target := 12345
+
+	c.H(regs...)
+	for j := 0; j < 8; j++ {
+		c.ApplyPhaseOracle(func(x int) bool { return x == target }, regs...)
+		c.H(regs...)
+		c.X(regs...)
+		c.Control(qsim.Z(), regs[1:], regs[:1])
+		c.X(regs...)
+		c.H(regs...)
+	}
+}
+
+func BenchmarkGroverGates(b *testing.B) {
+	benchmarkGates(b, 18, grover, 0)
+}
+
+func BenchmarkGroverGatesFused(b *testing.B) {
+	benchmarkGates(b, 18, grover, 2)
+}
+
+// benchmarkDeep applies 2000 gates to 8 qubits in parallel, where the per-gate overhead dominates.
+func benchmarkDeep(b *testing.B, cnt int) {
+	N := 8
+
+	for i := 0; i < b.N; i++ {
+		c := qsim.NewCircuit(N)
+		c.Option.PARALLEL_THRESHOLD = 0
+		c.Option.GOROUTINE_CNT = cnt
+
+		for d := 0; d < 100; d++ {
+			for q := 0; q < N; q++ {
+				c.RY(0.1*float64(d), q)
+			}
+			for q := 0; q+1 < N; q += 2 {
+				c.CX(q, q+1)
+			}
+			for q := 0; q+1 < N; q += 4 {
+				c.Swap(q, q+2)
+			}
+		}
+		c.Close()
+	}
+}
+
+func BenchmarkDeep(b *testing.B) {
+	benchmarkDeep(b, 1)
+}
+
+func BenchmarkDeepParallel(b *testing.B) {
+	benchmarkDeep(b, 4)
+}
+
+// benchmarkGate applies gate op controlled by ctrls to 20 qubits.
+func benchmarkGate(b *testing.B, op qsim.Gate, ctrls []int) {
+	N := 20
+	c := qsim.NewCircuit(N)
+	c.Option.PARALLEL_THRESHOLD = 24
+	c.Option.NO_RECORD = true
+
+	for i := 0; i < b.N; i++ {
+		for q := len(ctrls); q < N; q++ {
+			c.Control(op, ctrls, []int{q})
+		}
+	}
+}
+
+func BenchmarkGateDense(b *testing.B) {
+	benchmarkGate(b, qsim.H(), nil)
+}
+
+func BenchmarkGateX(b *testing.B) {
+	benchmarkGate(b, qsim.X(), nil)
+}
+
+func BenchmarkGateT(b *testing.B) {
+	benchmarkGate(b, qsim.T(), nil)
+}
+
+func BenchmarkGateCCX(b *testing.B) {
+	benchmarkGate(b, qsim.X(), []int{0, 1})
+}
+
+func BenchmarkGateCCRY(b *testing.B) {
+	benchmarkGate(b, qsim.RY(0.3), []int{0, 1})
+}
@@ -0,0 +1,171 @@
+package qsim
+
+import (
+	"github.com/sp301415/qsim/math/number"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// AddCbits adds n classical bits initialized to 0, and returns their indices.
+func (c *Circuit) AddCbits(n int) []int {
+	if n <= 0 {
+		panic("Invalid number of classical bits.")
+	}
+
+	r := slice.Range(len(c.cbits), len(c.cbits)+n)
+	c.cbits = append(c.cbits, make([]int, n)...)
+
+	return r
+}
+
+// Cbits returns the copy of current classical bits.
+func (c *Circuit) Cbits() []int {
+	return append([]int{}, c.cbits...)
+}
+
+// CbitsValue returns the value of classical bits cregs, where cregs[0] is the LSB.
+func (c *Circuit) CbitsValue(cregs ...int) int {
+	v := 0
+	for i, b := range cregs {
+		v |= c.cbits[b] << i
+	}
+
+	return v
+}
+
+// CIf records instructions in f conditioned on classical bits cregs having value.
+// Each instruction is executed only if the condition holds when it is reached.
+// Conditions cannot be nested.
+func (c *Circuit) CIf(cregs []int, value int, f func()) {
+	if c.cond != nil {
+		panic("Nested CIf is not supported.")
+	}
+
+	if len(cregs) == 0 {
+		panic("At least one classical bits required.")
+	}
+
+	if number.Min(cregs...) < 0 || number.Max(cregs...) >= len(c.cbits) {
+		panic("Classical bits out of range.")
+	}
+
+	if slice.HasDuplicate(cregs) {
+		panic("Duplicate classical bits.")
+	}
+
+	if value < 0 || value >= 1<<len(cregs) {
+		panic("Value does not fit in classical bits.")
+	}
+
+	cond := &Condition{Cbits: append([]int{}, cregs...), Value: value}
+	c.cond = cond
+	defer func() { c.cond = nil }()
+
+	f()
+}
+
+// exec records inst, and executes it unless its condition fails.
+// Instructions are not recorded if NO_RECORD is set, unless c only records instructions.
+// Returns the measurement result, or -1 if inst is not executed or not a measurement.
+func (c *Circuit) exec(inst Instruction) int {
+	inst = inst.Copy()
+	if c.cond != nil {
+		if inst.Cond != nil {
+			panic("Nested CIf is not supported.")
+		}
+		inst.Cond = &Condition{Cbits: c.cond.Cbits, Value: c.cond.Value}
+	}
+	if c.norun || !c.Option.NO_RECORD {
+		c.insts = append(c.insts, inst)
+	}
+
+	if c.norun || (inst.Cond != nil && !inst.Cond.Holds(c.cbits)) {
+		return -1
+	}
+
+	return c.step(inst)
+}
+
+// run executes inst on the state, ignoring its condition.
+func (c *Circuit) run(inst Instruction) int {
+	switch inst.Kind {
+	case KindGate:
+		if len(inst.Controls) == 0 {
+			c.state.applyGate(c, inst.Gate, inst.Targets)
+		} else {
+			c.state.controlGate(c, inst.Gate, inst.Controls, inst.Targets)
+		}
+	case KindOracle:
+		c.state.applyOracle(c, inst.Oracle, inst.Targets, inst.Outputs)
+	case KindPhaseOracle:
+		c.state.applyPhaseOracle(c, inst.PhaseOracle, inst.Targets)
+	case KindMeasure:
+		return c.state.measure(c, inst.Targets, inst.Cbits)
+	case KindReset:
+		c.reset(inst.Targets)
+	case KindBarrier:
+		// Barriers do nothing.
+	}
+
+	return -1
+}
+
+// Instructions returns the copy of recorded instructions.
+// Nothing is recorded while Option.NO_RECORD is set.
+func (c *Circuit) Instructions() []Instruction {
+	r := make([]Instruction, len(c.insts))
+	for i, inst := range c.insts {
+		r[i] = inst.Copy()
+	}
+
+	return r
+}
+
+// Run resets the state and classical bits, and runs every recorded instruction again.
+func (c *Circuit) Run() {
+	c.pending = fuser{}
+	c.state = newState(c.init, c.Size(), c.Option)
+	for i := range c.cbits {
+		c.cbits[i] = 0
+	}
+
+	for i := 0; i < len(c.insts); i++ {
+		if b, ok := c.blocks[i]; ok {
+			c.flush()
+			b.apply(c)
+			i += b.count - 1
+			continue
+		}
+
+		inst := c.insts[i]
+		if inst.Cond != nil && !inst.Cond.Holds(c.cbits) {
+			continue
+		}
+		c.step(inst)
+	}
+	c.flush()
+}
+
+// Counts runs the circuit shots times, and returns the counts of classical bits.
+// Keys are every classical bits packed as an integer, where bit 0 is the LSB.
+// State of c is not changed.
+func (c *Circuit) Counts(shots int) map[int]int {
+	r := &Circuit{
+		size:   c.Size(),
+		state:  newState(c.init, c.Size(), c.Option),
+		init:   c.init,
+		cbits:  make([]int, len(c.cbits)),
+		insts:  c.insts,
+		blocks: c.blocks,
+		Option: c.Option,
+	}
+	defer r.Close()
+
+	all := slice.Range(0, len(c.cbits))
+	counts := make(map[int]int)
+	for i := 0; i < shots; i++ {
+		r.Run()
+		counts[r.CbitsValue(all...)]++
+	}
+
+	return counts
+}
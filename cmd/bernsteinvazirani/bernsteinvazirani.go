@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/sp301415/qsim/algorithms/bernsteinvazirani"
+)
+
+func main() {
+	lenPtr := flag.Int("n", 0, "Number of qubits.")
+	secretPtr := flag.Int("s", -1, "Hidden string, as an integer.")
+
+	flag.Parse()
+
+	if *lenPtr == 0 {
+		panic("Invalid argument")
+	}
+
+	if *secretPtr < 0 || *secretPtr >= 1<<*lenPtr {
+		panic("Invalid argument")
+	}
+
+	n := *lenPtr
+	s := *secretPtr
+
+	r := bernsteinvazirani.BernsteinVazirani(n, bernsteinvazirani.InnerProductFunc(s))
+
+	if r == s {
+		fmt.Printf("Bernstein Vazirani Says: The hidden string is %0*b!\n", n, r)
+	} else {
+		fmt.Println("Seems like Bernstein Vazirani is wrong :(")
+	}
+}
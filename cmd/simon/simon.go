@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/sp301415/qsim/algorithms/simon"
+)
+
+func main() {
+	lenPtr := flag.Int("n", 0, "Number of qubits.")
+	maskPtr := flag.Int("s", -1, "Hidden mask, as an integer.")
+
+	flag.Parse()
+
+	if *lenPtr == 0 {
+		panic("Invalid argument")
+	}
+
+	if *maskPtr < 0 || *maskPtr >= 1<<*lenPtr {
+		panic("Invalid argument")
+	}
+
+	n := *lenPtr
+	s := *maskPtr
+
+	r := simon.Simon(n, simon.MaskFunc(s))
+
+	if r == s {
+		fmt.Printf("Simon Says: The hidden mask is %0*b!\n", n, r)
+	} else {
+		fmt.Println("Seems like Simon is wrong :(")
+	}
+}
@@ -0,0 +1,205 @@
+package qsim
+
+import (
+	"github.com/sp301415/qsim/math/number"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// NewRecorder returns a circuit of size n which only records instructions, without simulating them.
+// This is useful for building sub circuits, or estimating resources of circuits too large to simulate.
+func NewRecorder(n int) *Circuit {
+	c := NewCircuit(0)
+	c.size = n
+	c.state = nil
+	c.norun = true
+
+	return c
+}
+
+// derive returns an empty circuit with the same size, classical bits, registers and options as c.
+func (c *Circuit) derive() *Circuit {
+	var r *Circuit
+	if c.norun {
+		r = NewRecorder(c.Size())
+	} else {
+		r = NewCircuit(0)
+		r.size = c.Size()
+		r.state = newState(0, c.Size(), c.Option)
+	}
+
+	r.cbits = make([]int, len(c.cbits))
+	r.qregs = append(r.qregs, c.qregs...)
+	r.qnames = append(r.qnames, c.qnames...)
+	r.cregs = append(r.cregs, c.cregs...)
+	r.cnames = append(r.cnames, c.cnames...)
+	r.Option = c.Option
+
+	return r
+}
+
+// Rebuild returns a new circuit with the same size, classical bits, registers and options as c,
+// which applies insts instead of the instructions of c, starting from |0>.
+// Panics if insts refer to qubits or classical bits which c does not have.
+func (c *Circuit) Rebuild(insts []Instruction) *Circuit {
+	for _, inst := range insts {
+		if qs := inst.Qubits(); len(qs) > 0 && (number.Min(qs...) < 0 || number.Max(qs...) >= c.Size()) {
+			panic("Registers out of range.")
+		}
+
+		cbits := inst.Cbits
+		if inst.Cond != nil {
+			cbits = append(append([]int{}, cbits...), inst.Cond.Cbits...)
+		}
+		if len(cbits) > 0 && (number.Min(cbits...) < 0 || number.Max(cbits...) >= len(c.cbits)) {
+			panic("Classical bits out of range.")
+		}
+	}
+
+	r := c.derive()
+	for _, inst := range insts {
+		r.exec(inst)
+	}
+
+	return r
+}
+
+// Inverse returns a new circuit applying the inverse of c, starting from |0>.
+// Instructions are reversed, and each gate is replaced by its adjoint.
+// Oracles are their own inverses. Panics if c has measurements, resets or classical conditions.
+func (c *Circuit) Inverse() *Circuit {
+	r := c.derive()
+
+	for i := len(c.insts) - 1; i >= 0; i-- {
+		inst := c.insts[i]
+
+		if inst.Kind == KindMeasure || inst.Kind == KindReset || inst.Cond != nil {
+			panic("Cannot invert measurements, resets or classical conditions.")
+		}
+
+		if inst.Kind == KindGate {
+			inst.Gate = inst.Gate.Dagger()
+		}
+		r.exec(inst)
+	}
+
+	return r
+}
+
+// Power returns a new circuit applying c k times, starting from |0>.
+// If k < 0, the inverse of c is applied -k times.
+func (c *Circuit) Power(k int) *Circuit {
+	if k < 0 {
+		return c.Inverse().Power(-k)
+	}
+
+	r := c.derive()
+	for i := 0; i < k; i++ {
+		for _, inst := range c.insts {
+			r.exec(inst)
+		}
+	}
+
+	return r
+}
+
+// Controlled returns a new circuit applying c controlled by qubits cregs, starting from |0>.
+// Every gate is applied through Control, and oracles act only when every control qubit is 1.
+// Control qubits should be qubits of c which are not used by any instruction.
+// Panics if c has measurements or resets.
+func (c *Circuit) Controlled(cregs []int) *Circuit {
+	if len(cregs) == 0 {
+		panic("At least one control registers required.")
+	}
+
+	if number.Min(cregs...) < 0 || number.Max(cregs...) >= c.Size() {
+		panic("Registers out of range.")
+	}
+
+	if slice.HasDuplicate(cregs) {
+		panic("Duplicate registers.")
+	}
+
+	r := c.derive()
+	for _, inst := range c.insts {
+		if inst.Kind == KindMeasure || inst.Kind == KindReset {
+			panic("Cannot control measurements or resets.")
+		}
+
+		if inst.Kind == KindBarrier {
+			r.exec(inst)
+			continue
+		}
+
+		if slice.HasCommon(cregs, inst.Qubits()) {
+			panic("Control registers are used by the circuit.")
+		}
+
+		inst = inst.Copy()
+		n := len(inst.Targets)
+		mask := (1 << n) - 1
+		on := func(x int) bool { return x>>n == (1<<len(cregs))-1 }
+
+		switch inst.Kind {
+		case KindGate:
+			inst.Controls = append(inst.Controls, cregs...)
+		case KindOracle:
+			f := inst.Oracle
+			inst.Oracle = func(x int) int {
+				if on(x) {
+					return f(x & mask)
+				}
+				return 0
+			}
+			inst.Targets = append(inst.Targets, cregs...)
+		case KindPhaseOracle:
+			f := inst.PhaseOracle
+			inst.PhaseOracle = func(x int) bool { return on(x) && f(x&mask) }
+			inst.Targets = append(inst.Targets, cregs...)
+		}
+		r.exec(inst)
+	}
+
+	return r
+}
+
+// Append applies every instruction of other to c.
+// Qubit i of other is mapped to qubitMap[i] of c. If qubitMap is nil, qubits are mapped to themselves.
+// Classical bits are mapped to themselves.
+func (c *Circuit) Append(other *Circuit, qubitMap []int) {
+	if qubitMap == nil {
+		qubitMap = slice.Range(0, other.Size())
+	}
+
+	if len(qubitMap) != other.Size() {
+		panic("Qubit map size does not match the circuit.")
+	}
+
+	if len(qubitMap) > 0 {
+		if number.Min(qubitMap...) < 0 || number.Max(qubitMap...) >= c.Size() {
+			panic("Registers out of range.")
+		}
+
+		if slice.HasDuplicate(qubitMap) {
+			panic("Duplicate registers.")
+		}
+	}
+
+	if len(other.cbits) > len(c.cbits) {
+		panic("Classical bits out of range.")
+	}
+
+	remap := func(qs []int) []int {
+		r := make([]int, len(qs))
+		for i, q := range qs {
+			r[i] = qubitMap[q]
+		}
+		return r
+	}
+
+	for _, inst := range other.insts {
+		inst.Controls = remap(inst.Controls)
+		inst.Targets = remap(inst.Targets)
+		inst.Outputs = remap(inst.Outputs)
+		c.exec(inst)
+	}
+}
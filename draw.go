@@ -0,0 +1,238 @@
+package qsim
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sp301415/qsim/math/number"
+)
+
+// cell is a symbol of an instruction on one qubit.
+type cell struct {
+	text string // Text drawn on the wire. Empty if the wire just passes.
+	down bool   // True if a vertical line goes to the next qubit.
+}
+
+// qubitLabels returns the labels of qubits, using register names if possible.
+func (c *Circuit) qubitLabels() []string {
+	labels := make([]string, c.Size())
+	for i := range labels {
+		labels[i] = fmt.Sprintf("q[%d]", i)
+	}
+
+	for i, reg := range c.qregs {
+		for j, q := range reg {
+			labels[q] = fmt.Sprintf("%s[%d]", c.qnames[i], j)
+		}
+	}
+
+	return labels
+}
+
+// gateLabel returns the label of a gate, with its parameters if any.
+func gateLabel(g Gate) string {
+	if len(g.params) == 0 {
+		return g.name
+	}
+
+	ps := make([]string, len(g.params))
+	for i, p := range g.params {
+		ps[i] = fmt.Sprintf("%.3g", p)
+	}
+
+	return g.name + "(" + strings.Join(ps, ",") + ")"
+}
+
+// cells returns the symbols of inst on each qubit it acts on.
+func (inst Instruction) cells() map[int]string {
+	r := make(map[int]string)
+
+	suffix := ""
+	if inst.Cond != nil {
+		suffix = fmt.Sprintf(" if c%v=%d", inst.Cond.Cbits, inst.Cond.Value)
+	}
+
+	box := func(s string) string {
+		return "[" + s + suffix + "]"
+	}
+
+	switch inst.Kind {
+	case KindGate:
+		for _, q := range inst.Controls {
+			r[q] = "*"
+		}
+
+		if inst.Gate.is(SWAP()) {
+			for _, q := range inst.Targets {
+				r[q] = "x"
+			}
+			break
+		}
+
+		label := gateLabel(inst.Gate)
+		for i, q := range inst.Targets {
+			if len(inst.Targets) == 1 {
+				r[q] = box(label)
+			} else {
+				r[q] = box(fmt.Sprintf("%s:%d", label, i))
+			}
+		}
+	case KindOracle:
+		for i, q := range inst.Targets {
+			r[q] = box(fmt.Sprintf("Uf:x%d", i))
+		}
+		for i, q := range inst.Outputs {
+			r[q] = box(fmt.Sprintf("Uf:y%d", i))
+		}
+	case KindPhaseOracle:
+		for i, q := range inst.Targets {
+			r[q] = box(fmt.Sprintf("Pf:%d", i))
+		}
+	case KindMeasure:
+		for i, q := range inst.Targets {
+			if len(inst.Cbits) > 0 {
+				r[q] = box(fmt.Sprintf("M>c%d", inst.Cbits[i]))
+			} else {
+				r[q] = box("M")
+			}
+		}
+	case KindReset:
+		for _, q := range inst.Targets {
+			r[q] = box("|0>")
+		}
+	case KindBarrier:
+		for _, q := range inst.Targets {
+			r[q] = "|"
+		}
+	}
+
+	return r
+}
+
+// layers assigns instructions to columns, so that instructions on disjoint qubit ranges share a column.
+// An instruction occupies every qubit between its smallest and largest qubit,
+// since its vertical line crosses them. Classical bits read or written are also occupied.
+func (c *Circuit) layers() [][]Instruction {
+	level := make([]int, c.Size())
+	clevel := make([]int, len(c.cbits))
+	cols := make([][]Instruction, 0)
+
+	for _, inst := range c.insts {
+		qs := inst.Qubits()
+		lo, hi := number.Min(qs...), number.Max(qs...)
+		cs := append([]int{}, inst.Cbits...)
+		if inst.Cond != nil {
+			cs = append(cs, inst.Cond.Cbits...)
+		}
+
+		col := 0
+		for q := lo; q <= hi; q++ {
+			if level[q] > col {
+				col = level[q]
+			}
+		}
+		for _, b := range cs {
+			if clevel[b] > col {
+				col = clevel[b]
+			}
+		}
+
+		for q := lo; q <= hi; q++ {
+			level[q] = col + 1
+		}
+		for _, b := range cs {
+			clevel[b] = col + 1
+		}
+
+		if col == len(cols) {
+			cols = append(cols, make([]Instruction, 0))
+		}
+		cols[col] = append(cols[col], inst)
+	}
+
+	return cols
+}
+
+// center returns s centered in width w, padded with pad.
+func center(s string, w int, pad byte) string {
+	l := (w - len(s)) / 2
+	return strings.Repeat(string(pad), l) + s + strings.Repeat(string(pad), w-len(s)-l)
+}
+
+// Draw returns the text diagram of recorded instructions, with one wire per qubit.
+// Gates are drawn as boxes, controls as *, swaps as x, and barriers as |.
+// Measurements are drawn as M, with the classical bit they are stored to.
+// Instructions acting on disjoint qubits are drawn in the same column.
+func (c *Circuit) Draw() string {
+	n := c.Size()
+	if n == 0 {
+		return ""
+	}
+
+	labels := c.qubitLabels()
+	lw := 0
+	for _, l := range labels {
+		if len(l) > lw {
+			lw = len(l)
+		}
+	}
+
+	// Row 2q is the wire of qubit q, and row 2q+1 is the gap below it.
+	rows := make([]strings.Builder, 2*n-1)
+	for q := 0; q < n; q++ {
+		rows[2*q].WriteString(fmt.Sprintf("%-*s: -", lw, labels[q]))
+		if q < n-1 {
+			rows[2*q+1].WriteString(strings.Repeat(" ", lw+3))
+		}
+	}
+
+	for _, col := range c.layers() {
+		cells := make([]cell, n)
+		for _, inst := range col {
+			qs := inst.Qubits()
+			lo, hi := number.Min(qs...), number.Max(qs...)
+
+			for q, s := range inst.cells() {
+				cells[q].text = s
+			}
+
+			for q := lo; q <= hi; q++ {
+				if cells[q].text == "" {
+					cells[q].text = "+"
+					if inst.Kind == KindBarrier {
+						cells[q].text = "|"
+					}
+				}
+				cells[q].down = q < hi
+			}
+		}
+
+		w := 1
+		for _, cl := range cells {
+			if len(cl.text) > w {
+				w = len(cl.text)
+			}
+		}
+		if w%2 == 0 {
+			w++
+		}
+
+		for q, cl := range cells {
+			rows[2*q].WriteString(center(cl.text, w, '-') + "-")
+			if q < n-1 {
+				if cl.down {
+					rows[2*q+1].WriteString(center("|", w, ' ') + " ")
+				} else {
+					rows[2*q+1].WriteString(strings.Repeat(" ", w+1))
+				}
+			}
+		}
+	}
+
+	r := ""
+	for i := range rows {
+		r += strings.TrimRight(rows[i].String(), " ") + "\n"
+	}
+
+	return r
+}
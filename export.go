@@ -0,0 +1,349 @@
+package qsim
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/sp301415/qsim/math/number"
+)
+
+// texEscaper escapes characters with special meanings in LaTeX math mode.
+var texEscaper = strings.NewReplacer(
+	"\\", "\\backslash ",
+	"_", "\\_",
+	"&", "\\&",
+	"%", "\\%",
+	"#", "\\#",
+	"$", "\\$",
+	"{", "\\{",
+	"}", "\\}",
+	"^", "\\hat{}",
+	"~", "\\sim ",
+)
+
+// texName returns the LaTeX form of a gate name.
+func texName(name string) string {
+	parts := strings.Split(name, "*")
+	for i, p := range parts {
+		dg := strings.HasSuffix(p, "dg")
+		p = strings.TrimSuffix(p, "dg")
+
+		if len(p) == 2 && p[0] == 'R' {
+			p = "R_" + texEscaper.Replace(p[1:])
+		} else {
+			p = texEscaper.Replace(p)
+		}
+		if dg {
+			p += "^\\dagger"
+		}
+		parts[i] = p
+	}
+
+	return strings.Join(parts, " \\otimes ")
+}
+
+// texLabel returns the LaTeX label of inst, which is drawn inside boxes.
+func (inst Instruction) texLabel() string {
+	r := ""
+	switch inst.Kind {
+	case KindGate:
+		r = texName(inst.Gate.name)
+		if len(inst.Gate.params) > 0 {
+			ps := make([]string, len(inst.Gate.params))
+			for i, p := range inst.Gate.params {
+				ps[i] = fmt.Sprintf("%.3g", p)
+			}
+			r += "(" + strings.Join(ps, ",") + ")"
+		}
+	case KindOracle:
+		r = "U_f"
+	case KindPhaseOracle:
+		r = "P_f"
+	case KindReset:
+		r = "\\ket{0}"
+	}
+
+	if inst.Cond != nil {
+		bits := make([]string, len(inst.Cond.Cbits))
+		for i, b := range inst.Cond.Cbits {
+			bits[i] = fmt.Sprint(b)
+		}
+		r += fmt.Sprintf("\\text{ if } c_{%s}=%d", strings.Join(bits, ","), inst.Cond.Value)
+	}
+
+	return r
+}
+
+// boxed returns the qubits of inst drawn as one box, in ascending order.
+// Returns nil if inst is not drawn as a box.
+func (inst Instruction) boxed() []int {
+	var r []int
+	switch inst.Kind {
+	case KindGate:
+		if inst.Gate.is(SWAP()) || (inst.Gate.is(X()) && len(inst.Controls) > 0 && inst.Cond == nil) {
+			return nil
+		}
+		r = append([]int{}, inst.Targets...)
+	case KindOracle:
+		r = append(append([]int{}, inst.Targets...), inst.Outputs...)
+	case KindPhaseOracle, KindReset:
+		r = append([]int{}, inst.Targets...)
+	default:
+		return nil
+	}
+
+	sort.Ints(r)
+	return r
+}
+
+// isContiguous checks if sorted qs are consecutive integers.
+func isContiguous(qs []int) bool {
+	return qs[len(qs)-1]-qs[0] == len(qs)-1
+}
+
+// Quantikz returns the recorded circuit as a LaTeX quantikz environment.
+// Multi qubit gates and oracles on consecutive qubits are drawn as one box.
+func (c *Circuit) Quantikz() string {
+	n := c.Size()
+	labels := c.qubitLabels()
+
+	rows := make([][]string, n)
+	for q := range rows {
+		name, idx := labels[q], ""
+		if i := strings.Index(name, "["); i >= 0 {
+			name, idx = name[:i], strings.Trim(name[i:], "[]")
+		}
+		rows[q] = []string{fmt.Sprintf("\\lstick{$%s_{%s}$}", texEscaper.Replace(name), idx)}
+	}
+
+	for _, col := range c.layers() {
+		cells := make([]string, n)
+		for q := range cells {
+			cells[q] = "\\qw"
+		}
+
+		for _, inst := range col {
+			qs := inst.Qubits()
+			lo, hi := number.Min(qs...), number.Max(qs...)
+			label := inst.texLabel()
+
+			switch inst.Kind {
+			case KindMeasure:
+				for _, q := range inst.Targets {
+					cells[q] = fmt.Sprintf("\\meter{%s}", label)
+				}
+				continue
+			case KindBarrier:
+				cells[lo] = "\\qw \\slice{}"
+				continue
+			}
+
+			box := inst.boxed()
+			if box != nil {
+				if isContiguous(box) {
+					if len(box) == 1 {
+						cells[box[0]] = fmt.Sprintf("\\gate{%s}", label)
+					} else {
+						cells[box[0]] = fmt.Sprintf("\\gate[%d]{%s}", len(box), label)
+						for _, q := range box[1:] {
+							cells[q] = ""
+						}
+					}
+				} else {
+					for i, q := range box {
+						cells[q] = fmt.Sprintf("\\gate{{%s}_{%d}}", label, i)
+					}
+				}
+			} else if inst.Gate.is(SWAP()) {
+				for _, q := range inst.Targets {
+					cells[q] = "\\targX{}"
+				}
+			} else {
+				cells[inst.Targets[0]] = "\\targ{}"
+			}
+
+			for _, q := range inst.Controls {
+				cells[q] = "\\control{}"
+			}
+
+			// Multi qubit box without controls already covers every qubit.
+			if lo == hi || (box != nil && isContiguous(box) && len(inst.Controls) == 0) {
+				continue
+			}
+
+			// Vertical line is drawn from the top qubit to the bottom qubit.
+			switch cells[lo] {
+			case "\\control{}":
+				cells[lo] = fmt.Sprintf("\\ctrl{%d}", hi-lo)
+			case "\\targX{}":
+				cells[lo] = fmt.Sprintf("\\swap{%d}", hi-lo)
+			default:
+				cells[lo] += fmt.Sprintf(" \\vqw{%d}", hi-lo)
+			}
+		}
+
+		for q := range rows {
+			rows[q] = append(rows[q], cells[q])
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\\begin{quantikz}\n")
+	for q, row := range rows {
+		sb.WriteString(strings.Join(append(row, "\\qw"), " & "))
+		if q < n-1 {
+			sb.WriteString(" \\\\")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\\end{quantikz}\n")
+
+	return sb.String()
+}
+
+// SVG layout constants.
+const (
+	svgWire   = 40 // Distance between wires.
+	svgMargin = 20 // Margin around the diagram.
+	svgBox    = 30 // Height of gate boxes.
+	svgChar   = 8  // Approximate width of a character.
+)
+
+// svgText returns the plain text label of inst, which is drawn inside boxes.
+func (inst Instruction) svgText() string {
+	r := ""
+	switch inst.Kind {
+	case KindGate:
+		r = gateLabel(inst.Gate)
+	case KindOracle:
+		r = "Uf"
+	case KindPhaseOracle:
+		r = "Pf"
+	case KindReset:
+		r = "|0>"
+	case KindMeasure:
+		r = "M"
+	}
+
+	if inst.Cond != nil {
+		r += fmt.Sprintf(" if c%v=%d", inst.Cond.Cbits, inst.Cond.Value)
+	}
+
+	return r
+}
+
+// SVG returns the recorded circuit as a standalone SVG image.
+func (c *Circuit) SVG() string {
+	n := c.Size()
+	labels := c.qubitLabels()
+	cols := c.layers()
+
+	lw := 0
+	for _, l := range labels {
+		if len(l)*svgChar > lw {
+			lw = len(l) * svgChar
+		}
+	}
+
+	// Compute column widths.
+	widths := make([]int, len(cols))
+	for i, col := range cols {
+		widths[i] = svgBox
+		for _, inst := range col {
+			w := len(inst.svgText())*svgChar + 16
+			if inst.Kind == KindMeasure && len(inst.Cbits) > 0 {
+				w += 4 * svgChar
+			}
+			if w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	width := 2*svgMargin + lw + 10
+	for _, w := range widths {
+		width += w + 10
+	}
+	height := 2*svgMargin + (n-1)*svgWire + svgBox
+
+	y := func(q int) int { return svgMargin + svgBox/2 + q*svgWire }
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", width, height, width, height)
+	sb.WriteString("<rect width=\"100%\" height=\"100%\" fill=\"white\"/>\n")
+	sb.WriteString("<g font-family=\"monospace\" font-size=\"13\" stroke=\"black\" fill=\"none\">\n")
+
+	for q := 0; q < n; q++ {
+		fmt.Fprintf(&sb, "<text x=\"%d\" y=\"%d\" fill=\"black\" stroke=\"none\" dominant-baseline=\"middle\">%s</text>\n",
+			svgMargin, y(q), html.EscapeString(labels[q]))
+		fmt.Fprintf(&sb, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\"/>\n", svgMargin+lw+10, y(q), width-svgMargin, y(q))
+	}
+
+	box := func(x, w, y0, y1 int, text string) {
+		fmt.Fprintf(&sb, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"white\"/>\n",
+			x-w/2, y0-svgBox/2, w, y1-y0+svgBox)
+		fmt.Fprintf(&sb, "<text x=\"%d\" y=\"%d\" fill=\"black\" stroke=\"none\" text-anchor=\"middle\" dominant-baseline=\"middle\">%s</text>\n",
+			x, (y0+y1)/2, html.EscapeString(text))
+	}
+
+	x0 := svgMargin + lw + 10
+	for i, col := range cols {
+		x := x0 + widths[i]/2 + 5
+		for _, inst := range col {
+			qs := inst.Qubits()
+			lo, hi := number.Min(qs...), number.Max(qs...)
+			text := inst.svgText()
+			bw := widths[i] - 6
+
+			if inst.Kind == KindBarrier {
+				fmt.Fprintf(&sb, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke-dasharray=\"4,4\" stroke=\"gray\"/>\n",
+					x, y(lo)-svgBox/2, x, y(hi)+svgBox/2)
+				continue
+			}
+
+			if lo != hi {
+				fmt.Fprintf(&sb, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\"/>\n", x, y(lo), x, y(hi))
+			}
+
+			for _, q := range inst.Controls {
+				fmt.Fprintf(&sb, "<circle cx=\"%d\" cy=\"%d\" r=\"4\" fill=\"black\"/>\n", x, y(q))
+			}
+
+			switch {
+			case inst.Kind == KindMeasure:
+				for j, q := range inst.Targets {
+					t := text
+					if len(inst.Cbits) > 0 {
+						t = fmt.Sprintf("%s>c%d", text, inst.Cbits[j])
+					}
+					box(x, bw, y(q), y(q), t)
+				}
+			case inst.Kind == KindGate && inst.Gate.is(SWAP()):
+				for _, q := range inst.Targets {
+					fmt.Fprintf(&sb, "<path d=\"M %d %d l 10 10 M %d %d l 10 -10\"/>\n", x-5, y(q)-5, x-5, y(q)+5)
+				}
+			case inst.boxed() == nil:
+				// Controlled X.
+				t := y(inst.Targets[0])
+				fmt.Fprintf(&sb, "<circle cx=\"%d\" cy=\"%d\" r=\"10\" fill=\"white\"/>\n", x, t)
+				fmt.Fprintf(&sb, "<path d=\"M %d %d l 20 0 M %d %d l 0 20\"/>\n", x-10, t, x, t-10)
+			default:
+				qs := inst.boxed()
+				if isContiguous(qs) {
+					box(x, bw, y(qs[0]), y(qs[len(qs)-1]), text)
+				} else {
+					for j, q := range qs {
+						box(x, bw, y(q), y(q), fmt.Sprintf("%s:%d", text, j))
+					}
+				}
+			}
+		}
+		x0 += widths[i] + 10
+	}
+
+	sb.WriteString("</g>\n</svg>\n")
+
+	return sb.String()
+}
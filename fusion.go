@@ -0,0 +1,165 @@
+package qsim
+
+import (
+	"github.com/sp301415/qsim/math/mat"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// fuser fuses consecutive gates into a single dense gate, so that they are applied in one sweep of the state.
+type fuser struct {
+	qubits []int       // Qubits of the block. Bit i of the matrix index is qubits[i].
+	data   mat.Mat     // Matrix of the block.
+	first  Instruction // First instruction of the block.
+	count  int         // Number of fused instructions.
+}
+
+// fusible checks if inst can be fused into blocks of at most k qubits.
+func fusible(inst Instruction, k int) bool {
+	return k > 0 && inst.Kind == KindGate && inst.Cond == nil && len(inst.Controls)+len(inst.Targets) <= k
+}
+
+// fits checks if inst can be added to the block, keeping at most k qubits.
+func (f *fuser) fits(inst Instruction, k int) bool {
+	n := len(f.qubits)
+	for _, q := range append(append([]int{}, inst.Controls...), inst.Targets...) {
+		if !slice.Contains(f.qubits, q) {
+			n++
+		}
+	}
+
+	return n <= k
+}
+
+// add adds inst to the block. inst should fit in the block.
+func (f *fuser) add(inst Instruction) {
+	if f.count == 0 {
+		f.first = inst
+	}
+	f.count++
+
+	// Extend the block to new qubits, as I (x) data.
+	old := len(f.qubits)
+	for _, q := range append(append([]int{}, inst.Controls...), inst.Targets...) {
+		if !slice.Contains(f.qubits, q) {
+			f.qubits = append(f.qubits, q)
+		}
+	}
+
+	if f.data == nil {
+		f.data = mat.NewId(1 << len(f.qubits))
+	} else if len(f.qubits) > old {
+		f.data = mat.NewId(1 << (len(f.qubits) - old)).Tensor(f.data)
+	}
+
+	f.data = embed(inst, f.qubits).Mul(f.data)
+}
+
+// take returns the instruction applying the block, and empties the block.
+// If the block has only one instruction, it is returned as it is.
+func (f *fuser) take() (Instruction, bool) {
+	if f.count == 0 {
+		return Instruction{}, false
+	}
+
+	inst := f.first
+	if f.count > 1 {
+		g := Gate{data: f.data, size: len(f.qubits), name: "Fused"}
+		inst = Instruction{Kind: KindGate, Gate: g, Targets: f.qubits}
+	}
+	*f = fuser{}
+
+	return inst, true
+}
+
+// embed returns the matrix of gate inst on qubits, where bit i of the matrix index is qubits[i].
+func embed(inst Instruction, qubits []int) mat.Mat {
+	pos := make(map[int]int, len(qubits))
+	for i, q := range qubits {
+		pos[q] = i
+	}
+
+	cmask := 0
+	for _, q := range inst.Controls {
+		cmask |= 1 << pos[q]
+	}
+
+	m := mat.NewSquare(1 << len(qubits))
+	for x := range m {
+		if x&cmask != cmask {
+			m[x][x] = 1
+			continue
+		}
+
+		// Target bits of x, in the order of the gate.
+		tx, rest := 0, x
+		for i, q := range inst.Targets {
+			tx |= (x >> pos[q] & 1) << i
+			rest &^= 1 << pos[q]
+		}
+
+		for ty := 0; ty < 1<<len(inst.Targets); ty++ {
+			y := rest
+			for i, q := range inst.Targets {
+				y |= (ty >> i & 1) << pos[q]
+			}
+			m[y][x] = inst.Gate.data[ty][tx]
+		}
+	}
+
+	return m
+}
+
+// step executes inst, fusing it with the pending gates if FUSION_QUBITS > 0.
+// Returns the measurement result, or -1 if inst is not a measurement.
+func (c *Circuit) step(inst Instruction) int {
+	if k := c.Option.FUSION_QUBITS; fusible(inst, k) {
+		if !c.pending.fits(inst, k) {
+			c.flush()
+		}
+		c.pending.add(inst)
+		return -1
+	}
+
+	c.flush()
+	return c.run(inst)
+}
+
+// flush applies the pending fused gates.
+func (c *Circuit) flush() {
+	if inst, ok := c.pending.take(); ok {
+		c.run(inst)
+	}
+}
+
+// Plan returns the instructions executed by Run, where consecutive gates are fused
+// into blocks of at most FUSION_QUBITS qubits. Fused blocks are gates named "Fused".
+// Each instruction of the plan is a single sweep of the state, except for instructions
+// applied at once by fast kernels, such as QFT, which are listed gate by gate.
+// Therefore the plan may have more instructions than the sweeps of such circuits.
+func (c *Circuit) Plan() []Instruction {
+	k := c.Option.FUSION_QUBITS
+	r := make([]Instruction, 0, len(c.insts))
+
+	var f fuser
+	for _, inst := range c.insts {
+		if fusible(inst, k) {
+			if !f.fits(inst, k) {
+				fused, _ := f.take()
+				r = append(r, fused)
+			}
+			f.add(inst)
+			continue
+		}
+
+		if fused, ok := f.take(); ok {
+			r = append(r, fused)
+		}
+		r = append(r, inst.Copy())
+	}
+
+	if fused, ok := f.take(); ok {
+		r = append(r, fused)
+	}
+
+	return r
+}
@@ -3,27 +3,36 @@ package qsim
 import (
 	"math"
 	"math/cmplx"
+	"strings"
 
 	"github.com/sp301415/qsim/math/mat"
 	"github.com/sp301415/qsim/math/number"
 )
 
 type Gate struct {
-	data mat.Mat
-	size int
+	data   mat.Mat
+	size   int
+	name   string    // Name of the gate. Custom gates are named "U".
+	params []float64 // Parameters of the gate, such as the angle of P gate.
 }
 
 // NewGate allocates new gate of given matrix.
 func NewGate(m mat.Mat) Gate {
+	return NewNamedGate("U", m)
+}
+
+// NewNamedGate allocates new gate of given matrix, with the given name.
+// Names are used when the circuit is drawn or exported.
+func NewNamedGate(name string, m mat.Mat) Gate {
 	if !m.IsUnitary() {
 		panic("Matrix not unitary.")
 	}
 
-	if (m.NRows()&(m.NRows()-1) != 0) && (m.NRows() <= 0) {
+	if (m.NRows()&(m.NRows()-1) != 0) || (m.NRows() <= 0) {
 		panic("Matrix size should be a power of two.")
 	}
 
-	return Gate{data: m, size: number.BitLen(m.NRows()) - 1}
+	return Gate{data: m, size: number.BitLen(m.NRows()) - 1, name: name}
 }
 
 // ToMat copies the underlying mat and returns.
@@ -33,7 +42,17 @@ func (g Gate) ToMat() mat.Mat {
 
 // Copy copies g.
 func (g Gate) Copy() Gate {
-	return Gate{data: g.data.Copy()}
+	return Gate{data: g.data.Copy(), size: g.size, name: g.name, params: append([]float64{}, g.params...)}
+}
+
+// Name returns the name of the gate.
+func (g Gate) Name() string {
+	return g.name
+}
+
+// Params returns the parameters of the gate.
+func (g Gate) Params() []float64 {
+	return append([]float64{}, g.params...)
 }
 
 // Size returns the size of the gate. Here, size means the qubit length of a gate.
@@ -47,12 +66,80 @@ func (g Gate) At(i, j int) complex128 {
 	return g.data[i][j]
 }
 
+// Equals checks if two gates have the same matrix.
+func (g Gate) Equals(o Gate) bool {
+	return g.data.Equals(o.data)
+}
+
+// is checks if g has the name and exactly the matrix of o.
+// Names can be chosen freely by NewNamedGate, so gates are treated as o only if their matrices match.
+func (g Gate) is(o Gate) bool {
+	if g.name != o.name || len(g.data) != len(o.data) {
+		return false
+	}
+
+	for i := range g.data {
+		for j := range g.data[i] {
+			if g.data[i][j] != o.data[i][j] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 // Tensor returns the tensor product of g and given gate.
+// Note that o acts on the lower qubits, i.e. the first registers when applied.
 func (g Gate) Tensor(o Gate) Gate {
 	return Gate{
 		data: g.data.Tensor(o.data),
 		size: g.size + o.size,
+		name: g.name + "*" + o.name,
+	}
+}
+
+// Dagger returns the inverse of g.
+func (g Gate) Dagger() Gate {
+	r := Gate{data: g.data.Dagger(), size: g.size, name: g.name}
+
+	switch g.name {
+	case "P", "RX", "RY", "RZ":
+		// Gates built by NewNamedGate have no params, so they are daggered by name.
+		if len(g.params) == 1 {
+			r.params = []float64{-g.params[0]}
+			return r
+		}
+	case "U3":
+		if len(g.params) == 3 {
+			r.params = []float64{-g.params[0], -g.params[2], -g.params[1]}
+			return r
+		}
+	}
+
+	// Tensor products are daggered factorwise.
+	names := strings.Split(g.name, "*")
+	for i, n := range names {
+		names[i] = daggerName(n)
 	}
+	r.name = strings.Join(names, "*")
+
+	return r
+}
+
+// daggerName returns the name of the adjoint of a gate named name.
+func daggerName(name string) string {
+	switch name {
+	case "I", "X", "Y", "Z", "H", "SWAP":
+		// Hermitian gates.
+		return name
+	}
+
+	if strings.HasSuffix(name, "dg") {
+		return strings.TrimSuffix(name, "dg")
+	}
+
+	return name + "dg"
 }
 
 // Famous Gates.
@@ -65,6 +152,7 @@ func I() Gate {
 			{0, 1},
 		},
 		size: 1,
+		name: "I",
 	}
 }
 
@@ -76,6 +164,7 @@ func X() Gate {
 			{1, 0},
 		},
 		size: 1,
+		name: "X",
 	}
 }
 
@@ -86,6 +175,7 @@ func Y() Gate {
 		{1i, 0},
 	},
 		size: 1,
+		name: "Y",
 	}
 }
 
@@ -96,6 +186,7 @@ func Z() Gate {
 		{0, -1},
 	},
 		size: 1,
+		name: "Z",
 	}
 }
 
@@ -108,6 +199,7 @@ func H() Gate {
 			{h, -h},
 		},
 		size: 1,
+		name: "H",
 	}
 }
 
@@ -117,18 +209,102 @@ func P(phi float64) Gate {
 		{1, 0},
 		{0, cmplx.Rect(1, phi)},
 	},
-		size: 1,
+		size:   1,
+		name:   "P",
+		params: []float64{phi},
 	}
 }
 
 // S returns the S Gate. Same as P(pi/2).
 func S() Gate {
-	return P(math.Pi / 2.0)
+	g := P(math.Pi / 2.0)
+	g.name, g.params = "S", nil
+	return g
 }
 
 // T returns the T gate. Same as P(pi/4).
 func T() Gate {
-	return P(math.Pi / 4.0)
+	g := P(math.Pi / 4.0)
+	g.name, g.params = "T", nil
+	return g
+}
+
+// SX returns the SX Gate, which is the square root of X.
+func SX() Gate {
+	return Gate{data: [][]complex128{
+		{complex(0.5, 0.5), complex(0.5, -0.5)},
+		{complex(0.5, -0.5), complex(0.5, 0.5)},
+	},
+		size: 1,
+		name: "SX",
+	}
+}
+
+// RX returns the RX(theta) Gate, which rotates around the X axis.
+func RX(theta float64) Gate {
+	c := complex(math.Cos(theta/2.0), 0)
+	s := complex(0, -math.Sin(theta/2.0))
+	return Gate{data: [][]complex128{
+		{c, s},
+		{s, c},
+	},
+		size:   1,
+		name:   "RX",
+		params: []float64{theta},
+	}
+}
+
+// RY returns the RY(theta) Gate, which rotates around the Y axis.
+func RY(theta float64) Gate {
+	c := complex(math.Cos(theta/2.0), 0)
+	s := complex(math.Sin(theta/2.0), 0)
+	return Gate{data: [][]complex128{
+		{c, -s},
+		{s, c},
+	},
+		size:   1,
+		name:   "RY",
+		params: []float64{theta},
+	}
+}
+
+// RZ returns the RZ(theta) Gate, which rotates around the Z axis.
+func RZ(theta float64) Gate {
+	return Gate{data: [][]complex128{
+		{cmplx.Rect(1, -theta/2.0), 0},
+		{0, cmplx.Rect(1, theta/2.0)},
+	},
+		size:   1,
+		name:   "RZ",
+		params: []float64{theta},
+	}
+}
+
+// U3 returns the U3(theta, phi, lambda) Gate, which is a general one qubit gate.
+// U3(theta, phi, lambda) = exp(i(phi+lambda)/2) RZ(phi) RY(theta) RZ(lambda).
+func U3(theta, phi, lambda float64) Gate {
+	c, s := complex(math.Cos(theta/2.0), 0), complex(math.Sin(theta/2.0), 0)
+	return Gate{data: [][]complex128{
+		{c, -cmplx.Rect(1, lambda) * s},
+		{cmplx.Rect(1, phi) * s, cmplx.Rect(1, phi+lambda) * c},
+	},
+		size:   1,
+		name:   "U3",
+		params: []float64{theta, phi, lambda},
+	}
+}
+
+// SWAP returns the SWAP Gate.
+func SWAP() Gate {
+	return Gate{data: [][]complex128{
+		{1, 0, 0, 0},
+		{0, 0, 1, 0},
+		{0, 1, 0, 0},
+		{0, 0, 0, 1},
+	},
+		size: 2,
+		name: "SWAP",
+	}
 }
 
 // String implements Stringer interface.
@@ -0,0 +1,103 @@
+package qsim
+
+// Kind is the kind of an instruction.
+type Kind int
+
+const (
+	KindGate        Kind = iota // Unitary gate, possibly controlled.
+	KindOracle                  // Oracle from ApplyOracle.
+	KindPhaseOracle             // Phase oracle from ApplyPhaseOracle.
+	KindMeasure                 // Measurement.
+	KindReset                   // Reset to |0>.
+	KindBarrier                 // Barrier, which does nothing but separates instructions.
+)
+
+// String implements the Stringer interface.
+func (k Kind) String() string {
+	switch k {
+	case KindGate:
+		return "Gate"
+	case KindOracle:
+		return "Oracle"
+	case KindPhaseOracle:
+		return "PhaseOracle"
+	case KindMeasure:
+		return "Measure"
+	case KindReset:
+		return "Reset"
+	case KindBarrier:
+		return "Barrier"
+	}
+
+	return "Unknown"
+}
+
+// Condition is a classical condition of an instruction.
+// The instruction is executed only if classical bits Cbits hold Value.
+type Condition struct {
+	Cbits []int
+	Value int
+}
+
+// Holds checks if condition holds on given classical bits.
+func (cond Condition) Holds(cbits []int) bool {
+	v := 0
+	for i, b := range cond.Cbits {
+		v |= cbits[b] << i
+	}
+
+	return v == cond.Value
+}
+
+// Instruction is a recorded operation of a circuit.
+type Instruction struct {
+	Kind        Kind
+	Gate        Gate           // Gate to apply. Only for gate instructions.
+	Controls    []int          // Control qubits of gate.
+	Targets     []int          // Target qubits. For oracles, these are input registers.
+	Outputs     []int          // Output registers of oracle.
+	Oracle      func(int) int  // Oracle function.
+	PhaseOracle func(int) bool // Phase oracle function.
+	Cbits       []int          // Classical bits to store the measurement result. May be empty.
+	Cond        *Condition     // Classical condition. nil if unconditional.
+}
+
+// Qubits returns every qubit this instruction acts on.
+func (inst Instruction) Qubits() []int {
+	r := make([]int, 0, len(inst.Controls)+len(inst.Targets)+len(inst.Outputs))
+	r = append(r, inst.Controls...)
+	r = append(r, inst.Targets...)
+	r = append(r, inst.Outputs...)
+
+	return r
+}
+
+// Name returns the name of this instruction.
+// For gates, this is the name of the gate prefixed by "C" for each control.
+func (inst Instruction) Name() string {
+	if inst.Kind != KindGate {
+		return inst.Kind.String()
+	}
+
+	r := inst.Gate.Name()
+	for range inst.Controls {
+		r = "C" + r
+	}
+
+	return r
+}
+
+// Copy returns a deep copy of inst. Gates and functions are shared.
+func (inst Instruction) Copy() Instruction {
+	r := inst
+	r.Controls = append([]int{}, inst.Controls...)
+	r.Targets = append([]int{}, inst.Targets...)
+	r.Outputs = append([]int{}, inst.Outputs...)
+	r.Cbits = append([]int{}, inst.Cbits...)
+
+	if inst.Cond != nil {
+		r.Cond = &Condition{Cbits: append([]int{}, inst.Cond.Cbits...), Value: inst.Cond.Value}
+	}
+
+	return r
+}
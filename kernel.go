@@ -0,0 +1,310 @@
+package qsim
+
+import (
+	"math/bits"
+)
+
+// maxDense is the maximum number of qubits of gates applied by applyDense, applyDiagonal and applyPermutation.
+const maxDense = 6
+
+// bitmask returns the mask with bits of regs set.
+func bitmask(regs []int) int {
+	mask := 0
+	for _, r := range regs {
+		mask |= 1 << r
+	}
+
+	return mask
+}
+
+// offsets returns the index offset of each basis of iregs, where bit i of the basis is iregs[i].
+func offsets(iregs []int) []int {
+	r := make([]int, 1<<len(iregs))
+	for i, q := range iregs {
+		for x := range r {
+			r[x] |= (x >> i & 1) << q
+		}
+	}
+
+	return r
+}
+
+// deposit spreads bits of x into bit positions not in mask, from the lowest.
+func deposit(x, mask int) int {
+	r := 0
+	for b := 0; x > 0; b++ {
+		if mask>>b&1 == 1 {
+			continue
+		}
+		r |= (x & 1) << b
+		x >>= 1
+	}
+
+	return r
+}
+
+// next returns the next index after base, which has zeros on mask except control bits cmask.
+func next(base, mask, cmask int) int {
+	return ((base|mask)+1)&^mask | cmask
+}
+
+// bases calls f for chunks of indices with control bits cmask set and target bits tmask cleared.
+// f is given the first index of the chunk and the number of indices, which are enumerated by next.
+// Only 2^(n-k) indices are visited, where k is the number of control and target bits.
+func (c *Circuit) bases(cmask, tmask int, f func(base, count int)) {
+	mask := cmask | tmask
+	total := 1 << c.Size() >> bits.OnesCount(uint(mask))
+
+	if c.Size() <= c.Option.PARALLEL_THRESHOLD {
+		f(cmask, total)
+		return
+	}
+
+	c.parallel(total, func(start, end int) {
+		f(deposit(start, mask)|cmask, end-start)
+	})
+}
+
+// isDiagonal checks if op is a diagonal matrix.
+func isDiagonal(op Gate) bool {
+	for i, row := range op.data {
+		for j, v := range row {
+			if i != j && v != 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// permutation returns src and phase, where op maps basis src[y] to phase[y] times basis y.
+// Returns false if op is not a permutation matrix with phases, such as X, Y and CX.
+func permutation(op Gate) ([]int, []complex128, bool) {
+	d := len(op.data)
+	src := make([]int, d)
+	phase := make([]complex128, d)
+	used := make([]bool, d)
+
+	for y, row := range op.data {
+		src[y] = -1
+		for x, v := range row {
+			if v == 0 {
+				continue
+			}
+			if src[y] != -1 || used[x] {
+				return nil, nil, false
+			}
+			src[y], phase[y] = x, v
+			used[x] = true
+		}
+		if src[y] == -1 {
+			return nil, nil, false
+		}
+	}
+
+	return src, phase, true
+}
+
+// applySpecial applies op of at most maxDense qubits with control bits cmask,
+// if it is diagonal or a permutation. Returns false if op is neither.
+func (v *vector[T]) applySpecial(c *Circuit, op Gate, cmask int, iregs []int) bool {
+	if isDiagonal(op) {
+		v.applyDiagonal(c, op, cmask, iregs)
+		return true
+	}
+
+	if src, phase, ok := permutation(op); ok {
+		v.applyPermutation(c, src, phase, cmask, iregs)
+		return true
+	}
+
+	return false
+}
+
+// applyDiagonal applies diagonal gate op with control bits cmask.
+// Only amplitudes multiplied by entries other than 1 are touched, so phase gates such as Z, S, T and P
+// skip every amplitude with the target qubit 0.
+func (v *vector[T]) applyDiagonal(c *Circuit, op Gate, cmask int, iregs []int) {
+	type entry struct {
+		o int
+		v T
+	}
+
+	var entries []entry
+	for x, o := range offsets(iregs) {
+		if d := op.data[x][x]; d != 1 {
+			entries = append(entries, entry{o: o, v: T(d)})
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	tmask := bitmask(iregs)
+	mask := cmask | tmask
+	c.bases(cmask, tmask, func(base, count int) {
+		for j := 0; j < count; j++ {
+			for _, e := range entries {
+				v.data[base|e.o] *= e.v
+			}
+			base = next(base, mask, cmask)
+		}
+	})
+}
+
+// applyPermutation applies the gate mapping basis src[y] to phase[y] times basis y, with control bits cmask.
+// Amplitudes are only moved when the phase is 1, so X and SWAP do no arithmetic.
+func (v *vector[T]) applyPermutation(c *Circuit, src []int, phase []complex128, cmask int, iregs []int) {
+	type move struct {
+		dst, src int
+		v        T
+	}
+
+	if len(iregs) == 1 {
+		v.permuteOne(c, phase, cmask, iregs[0])
+		return
+	}
+
+	offs := offsets(iregs)
+	var moves []move
+	for y, x := range src {
+		if x != y || phase[y] != 1 {
+			moves = append(moves, move{dst: offs[y], src: offs[x], v: T(phase[y])})
+		}
+	}
+	if len(moves) == 0 {
+		return
+	}
+
+	tmask := bitmask(iregs)
+	mask := cmask | tmask
+	c.bases(cmask, tmask, func(base, count int) {
+		in := make([]T, len(moves))
+		for j := 0; j < count; j++ {
+			for m, mv := range moves {
+				in[m] = v.data[base|mv.src]
+			}
+			for m, mv := range moves {
+				if mv.v == 1 {
+					v.data[base|mv.dst] = in[m]
+				} else {
+					v.data[base|mv.dst] = mv.v * in[m]
+				}
+			}
+			base = next(base, mask, cmask)
+		}
+	})
+}
+
+// permuteOne applies the anti-diagonal one qubit gate with entries phase, with control bits cmask.
+func (v *vector[T]) permuteOne(c *Circuit, phase []complex128, cmask int, i int) {
+	plain := phase[0] == 1 && phase[1] == 1
+	p0, p1 := T(phase[0]), T(phase[1])
+	mask := cmask | 1<<i
+	c.bases(cmask, 1<<i, func(base, count int) {
+		for j := 0; j < count; j++ {
+			n0 := base
+			n1 := n0 | 1<<i
+
+			a0 := v.data[n0]
+			a1 := v.data[n1]
+
+			if plain {
+				v.data[n0], v.data[n1] = a1, a0
+			} else {
+				v.data[n0], v.data[n1] = p0*a1, p1*a0
+			}
+
+			base = next(base, mask, cmask)
+		}
+	})
+}
+
+// applyDense applies a gate of at most maxDense qubits with control bits cmask,
+// by gathering and updating 2^k amplitudes at once for each value of the other qubits.
+func (v *vector[T]) applyDense(c *Circuit, op Gate, cmask int, iregs []int) {
+	d := 1 << len(iregs)
+	offs := offsets(iregs)
+
+	// Nonzero entries of each row, since fused gates are often sparse.
+	type entry struct {
+		x int
+		v T
+	}
+	rows := make([][]entry, d)
+	for y := range rows {
+		for x := 0; x < d; x++ {
+			if a := op.data[y][x]; a != 0 {
+				rows[y] = append(rows[y], entry{x: x, v: T(a)})
+			}
+		}
+	}
+
+	tmask := bitmask(iregs)
+	mask := cmask | tmask
+	c.bases(cmask, tmask, func(base, count int) {
+		in := make([]T, d)
+		for j := 0; j < count; j++ {
+			for x, o := range offs {
+				in[x] = v.data[base|o]
+			}
+			for y, o := range offs {
+				amp := T(0)
+				for _, e := range rows[y] {
+					amp += e.v * in[e.x]
+				}
+				v.data[base|o] = amp
+			}
+			base = next(base, mask, cmask)
+		}
+	})
+}
+
+// controlOne applies one qubit gate with control bits cmask.
+func (v *vector[T]) controlOne(c *Circuit, op Gate, cmask int, i int) {
+	m := matrix[T](op)
+
+	mask := cmask | 1<<i
+	c.bases(cmask, 1<<i, func(base, count int) {
+		for j := 0; j < count; j++ {
+			n0 := base
+			n1 := n0 | 1<<i
+
+			a0 := v.data[n0]
+			a1 := v.data[n1]
+
+			v.data[n0] = a0*m[0][0] + a1*m[0][1]
+			v.data[n1] = a0*m[1][0] + a1*m[1][1]
+
+			base = next(base, mask, cmask)
+		}
+	})
+}
+
+// controlTwo applies two qubit gate with control bits cmask.
+func (v *vector[T]) controlTwo(c *Circuit, op Gate, cmask int, i0, i1 int) {
+	m := matrix[T](op)
+
+	mask := cmask | 1<<i0 | 1<<i1
+	c.bases(cmask, 1<<i0|1<<i1, func(base, count int) {
+		for j := 0; j < count; j++ {
+			n00 := base
+			n01 := n00 | 1<<i0
+			n10 := n00 | 1<<i1
+			n11 := n10 | 1<<i0
+
+			a00 := v.data[n00]
+			a01 := v.data[n01]
+			a10 := v.data[n10]
+			a11 := v.data[n11]
+
+			v.data[n00] = a00*m[0][0] + a01*m[0][1] + a10*m[0][2] + a11*m[0][3]
+			v.data[n01] = a00*m[1][0] + a01*m[1][1] + a10*m[1][2] + a11*m[1][3]
+			v.data[n10] = a00*m[2][0] + a01*m[2][1] + a10*m[2][2] + a11*m[2][3]
+			v.data[n11] = a00*m[3][0] + a01*m[3][1] + a10*m[3][2] + a11*m[3][3]
+
+			base = next(base, mask, cmask)
+		}
+	})
+}
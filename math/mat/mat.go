@@ -3,7 +3,9 @@ package mat
 
 import (
 	"fmt"
+	"math"
 	"math/cmplx"
+	"sort"
 
 	"github.com/sp301415/qsim/math/vec"
 )
@@ -134,6 +136,15 @@ func (m Mat) IsUnitary() bool {
 	return m.Mul(m.Dagger()).Equals(NewId(m.NRows()))
 }
 
+// IsHermitian checks if m is a hermitian matrix.
+func (m Mat) IsHermitian() bool {
+	if !m.IsSquare() {
+		return false
+	}
+
+	return m.Equals(m.Dagger())
+}
+
 // Helper functions.
 
 // NRows returns the number of rows. (or, the length of a column.)
@@ -169,7 +180,7 @@ func (m Mat) GetCol(i int) vec.Vec {
 // SetCol sets the ith column to given vector.
 func (m *Mat) SetCol(i int, v vec.Vec) {
 	for k := 0; k < m.NRows(); k++ {
-		(*m)[k][i] = v[i]
+		(*m)[k][i] = v[k]
 	}
 }
 
@@ -310,3 +321,81 @@ func (m Mat) String() string {
 
 	return r
 }
+
+// Decompositions.
+
+// EigenHermitian returns the eigenvalues in ascending order and the corresponding eigenvectors of hermitian m.
+// The ith column of returned matrix is the eigenvector of ith eigenvalue.
+// This uses cyclic Jacobi method.
+func (m Mat) EigenHermitian() ([]float64, Mat) {
+	if !m.IsHermitian() {
+		panic("Matrix not hermitian.")
+	}
+
+	n := m.NRows()
+	a := m.Copy()
+	v := NewId(n)
+
+	for sweep := 0; sweep < 100; sweep++ {
+		off := 0.0
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				off += cmplx.Abs(a[p][q]) * cmplx.Abs(a[p][q])
+			}
+		}
+		if off < 1e-30 {
+			break
+		}
+
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				r := cmplx.Abs(a[p][q])
+				if r < 1e-300 {
+					continue
+				}
+
+				// Rotate the phase so that a[p][q] is real, then apply real Jacobi rotation.
+				e := cmplx.Conj(a[p][q]) / complex(r, 0)
+				theta := math.Atan2(2*r, real(a[p][p])-real(a[q][q])) / 2
+				c := complex(math.Cos(theta), 0)
+				s := complex(math.Sin(theta), 0)
+
+				// J = [[c, -s], [e*s, e*c]] on (p, q).
+				j00, j01, j10, j11 := c, -s, e*s, e*c
+
+				for k := 0; k < n; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p] = akp*j00 + akq*j10
+					a[k][q] = akp*j01 + akq*j11
+
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p] = vkp*j00 + vkq*j10
+					v[k][q] = vkp*j01 + vkq*j11
+				}
+
+				for k := 0; k < n; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k] = cmplx.Conj(j00)*apk + cmplx.Conj(j10)*aqk
+					a[q][k] = cmplx.Conj(j01)*apk + cmplx.Conj(j11)*aqk
+				}
+			}
+		}
+	}
+
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return real(a[idx[i]][idx[i]]) < real(a[idx[j]][idx[j]]) })
+
+	vals := make([]float64, n)
+	vecs := NewSquare(n)
+	for i, k := range idx {
+		vals[i] = real(a[k][k])
+		for r := 0; r < n; r++ {
+			vecs[r][i] = v[r][k]
+		}
+	}
+
+	return vals, vecs
+}
@@ -103,6 +103,12 @@ func TestGetSetRowCol(t *testing.T) {
 	if !I2.Equals(m2) {
 		t.Fail()
 	}
+
+	I2.SetCol(1, vec.NewVecVars(3, 4))
+
+	if !I2.Equals(mat.NewMatVars(2, 2, 3, 2, 4)) {
+		t.Fail()
+	}
 }
 
 func TestDim(t *testing.T) {
@@ -193,3 +199,34 @@ func TestDagger(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestEigenHermitian(t *testing.T) {
+	m := mat.NewMatSlice(
+		[][]complex128{
+			{2, 1 - 1i, 0.5i},
+			{1 + 1i, -1, 3},
+			{-0.5i, 3, 0.5},
+		},
+	)
+
+	vals, vecs := m.EigenHermitian()
+
+	if !vecs.IsUnitary() {
+		t.Fail()
+	}
+
+	for i := 1; i < len(vals); i++ {
+		if vals[i-1] > vals[i] {
+			t.Fail()
+		}
+	}
+
+	d := mat.NewSquare(3)
+	for i, l := range vals {
+		d[i][i] = complex(l, 0)
+	}
+
+	if !vecs.Mul(d).Mul(vecs.Dagger()).Equals(m) {
+		t.Fail()
+	}
+}
@@ -49,6 +49,29 @@ func GCD(a, b int) int {
 	return a
 }
 
+// ModInverse returns the inverse of a modulo n.
+// Panics if a is not invertible.
+func ModInverse(a, n int) int {
+	if n <= 0 {
+		panic("Non-positive modulo not allowed.")
+	}
+
+	r0, r1 := n, ((a%n)+n)%n
+	t0, t1 := 0, 1
+
+	for r1 != 0 {
+		q := r0 / r1
+		r0, r1 = r1, r0-q*r1
+		t0, t1 = t1, t0-q*t1
+	}
+
+	if r0 != 1 {
+		panic("Not invertible.")
+	}
+
+	return ((t0 % n) + n) % n
+}
+
 // BitLen returns binary length of n.
 // If n == 0, it returns 1. If n < 0, it panics.
 func BitLen(n int) int {
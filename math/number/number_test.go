@@ -27,6 +27,16 @@ func TestGCD(t *testing.T) {
 	}
 }
 
+func TestModInverse(t *testing.T) {
+	if number.ModInverse(7, 15) != 13 {
+		t.Fail()
+	}
+
+	if (number.ModInverse(-3, 11)*8)%11 != 1 {
+		t.Fail()
+	}
+}
+
 func TestBinLen(t *testing.T) {
 	n := 1545
 	l := len(fmt.Sprintf("%b", n))
@@ -0,0 +1,106 @@
+package qsim
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// minQubits is the number of qubits always supported in double precision, regardless of the available memory.
+const minQubits = 24
+
+// maxSupportedQubits bounds the number of qubits given by MAX_QUBITS or derived from the available memory,
+// so that sizes do not overflow.
+const maxSupportedQubits = 40
+
+// EstimateMemory returns the number of bytes of the state of a circuit with nbits qubits, allocated by NewCircuit.
+// State and Counts allocate copies of the state, which needs 16 * 2^nbits bytes more.
+func EstimateMemory(nbits int) uint64 {
+	return DefaultOptions().EstimateMemory(nbits)
+}
+
+// EstimateMemory returns the number of bytes of the state of a circuit with nbits qubits and options o.
+// This is the memory allocated by NewCircuitWithOptions, which doubles unless LAZY_TEMP is set.
+func (o Options) EstimateMemory(nbits int) uint64 {
+	amp := uint64(16)
+	if o.SINGLE_PRECISION {
+		amp = 8
+	}
+
+	r := amp << nbits
+	if !o.LAZY_TEMP {
+		r *= 2
+	}
+
+	return r
+}
+
+// maxQubits returns the maximum number of qubits supported with o.
+// If MAX_QUBITS is not set, it is the largest number of qubits whose state fits in the available memory,
+// but at least 24, or 25 in single precision.
+func (o Options) maxQubits() int {
+	if o.MAX_QUBITS > maxSupportedQubits {
+		panic(fmt.Sprintf("MAX_QUBITS should be at most %d.", maxSupportedQubits))
+	}
+
+	if o.MAX_QUBITS > 0 {
+		return o.MAX_QUBITS
+	}
+
+	n := minQubits
+	if o.SINGLE_PRECISION {
+		n++
+	}
+
+	if avail, ok := availableMemory(); ok {
+		for n < maxSupportedQubits && o.EstimateMemory(n+1) <= avail {
+			n++
+		}
+	}
+
+	return n
+}
+
+// checkQubits panics if circuits with nbits qubits are not supported with o.
+func (o Options) checkQubits(nbits int) {
+	if nbits < 0 {
+		panic("Invalid number of qubits.")
+	}
+
+	// Small circuits are always supported, without reading the available memory.
+	if o.MAX_QUBITS <= 0 && nbits <= minQubits {
+		return
+	}
+
+	if max := o.maxQubits(); nbits > max {
+		panic(fmt.Sprintf("Unsupported amount of qubits. Currently qsim supports up to %d qubits.", max))
+	}
+}
+
+// availableMemory returns the available memory in bytes, read from /proc/meminfo.
+// Returns false if it is not available, such as on systems other than Linux.
+func availableMemory() (uint64, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return kb << 10, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,61 @@
+package qsim
+
+import (
+	"testing"
+
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// hasTemp checks if the temp buffer of the state of c is allocated.
+func hasTemp(c *Circuit) bool {
+	c.flush()
+	return c.state.(*vector[complex128]).temp != nil
+}
+
+// hadamards returns H on n qubits, as a single gate.
+func hadamards(n int) Gate {
+	g := H()
+	for i := 1; i < n; i++ {
+		g = g.Tensor(H())
+	}
+
+	return g
+}
+
+func TestLazyTemp(t *testing.T) {
+	opt := DefaultOptions()
+	opt.LAZY_TEMP = true
+
+	for _, thr := range []int{0, 10} {
+		opt.PARALLEL_THRESHOLD = thr
+
+		for _, last := range []func(c *Circuit){
+			func(c *Circuit) { c.ApplyOracle(func(x int) int { return x }, []int{0, 1}, []int{2, 3}) },
+			func(c *Circuit) { c.Apply(hadamards(7), slice.Range(0, 7)...) },
+			func(c *Circuit) { c.Control(hadamards(7), []int{7}, slice.Range(0, 7)) },
+		} {
+			c := NewCircuitWithOptions(8, opt)
+			regs := slice.Range(0, 8)
+
+			c.H(regs...)
+			c.CX(0, 1)
+			c.CCX(0, 1, 2)
+			c.Swap(3, 4)
+			c.RY(0.3, 5)
+			c.Apply(H().Tensor(T()).Tensor(S()), 0, 3, 6)
+			c.Apply(hadamards(6), slice.Range(0, 6)...)
+			c.QFT(regs...)
+			c.ApplyPhaseOracle(func(x int) bool { return x == 3 }, regs...)
+			c.Measure(7)
+			if hasTemp(c) {
+				t.Fatalf("%d: temp allocated before needed", thr)
+			}
+
+			last(c)
+			if !hasTemp(c) {
+				t.Fatalf("%d: temp not allocated", thr)
+			}
+			c.Close()
+		}
+	}
+}
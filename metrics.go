@@ -0,0 +1,260 @@
+package qsim
+
+import (
+	"fmt"
+	"math"
+)
+
+// Metrics are the statistics of recorded instructions.
+type Metrics struct {
+	Size     int            // Number of instructions, excluding barriers.
+	Depth    int            // Number of moments.
+	Qubits   int            // Number of qubits used by any instruction.
+	TwoQubit int            // Number of instructions acting on two qubits.
+	TCount   int            // Number of T and Tdg gates.
+	TDepth   int            // Largest number of T and Tdg gates on any path.
+	CXCount  int            // Number of CX gates after decomposition. Oracles are not counted.
+	Counts   map[string]int // Number of instructions by name, such as "H" or "CCX".
+}
+
+// isT checks if inst is an uncontrolled T or Tdg gate.
+func (inst Instruction) isT() bool {
+	return inst.Kind == KindGate && len(inst.Controls) == 0 && (inst.Gate.name == "T" || inst.Gate.name == "Tdg")
+}
+
+// cxMCX returns the number of CX gates to implement X with k controls without ancillas.
+func cxMCX(k int) int {
+	switch k {
+	case 0:
+		return 0
+	case 1:
+		return 1
+	case 2:
+		return 6
+	}
+
+	// Lemma 7.5 of Barenco et al., with V = sqrt(X).
+	return 2*cxMCU(1) + 2*cxMCX(k-1) + cxMCU(k-1)
+}
+
+// cxMCU returns the number of CX gates to implement a one qubit unitary with k controls without ancillas.
+func cxMCU(k int) int {
+	switch k {
+	case 0:
+		return 0
+	case 1:
+		return 2
+	case 2:
+		return 8
+	}
+
+	return 2*cxMCU(1) + 2*cxMCX(k-1) + cxMCU(k-1)
+}
+
+// cxUnitary returns the number of CX gates to implement a general unitary on n qubits,
+// which is 3 for two qubits, and the quantum Shannon decomposition bound otherwise.
+func cxUnitary(n int) int {
+	switch n {
+	case 0, 1:
+		return 0
+	case 2:
+		return 3
+	}
+
+	return int(math.Ceil(23.0/48.0*math.Pow(4, float64(n)) - 1.5*math.Pow(2, float64(n)) + 4.0/3.0))
+}
+
+// cxCount returns the number of CX gates to implement inst.
+func (inst Instruction) cxCount() int {
+	if inst.Kind != KindGate {
+		return 0
+	}
+
+	k := len(inst.Controls)
+	switch {
+	case inst.Gate.is(I()):
+		return 0
+	case inst.Gate.is(SWAP()) && k == 0:
+		return 3
+	case inst.Gate.is(SWAP()):
+		// Controlled SWAP is CX, then X with k+1 controls, then CX.
+		return 2 + cxMCX(k+1)
+	case inst.Gate.Size() == 1:
+		switch inst.Gate.name {
+		case "X", "Y", "Z":
+			// Equivalent to X up to one qubit gates.
+			return cxMCX(k)
+		}
+		return cxMCU(k)
+	}
+
+	return cxUnitary(k + inst.Gate.Size())
+}
+
+// boolInt returns 1 if b is true, and 0 otherwise.
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// schedule assigns each instruction to a moment as soon as possible.
+// Returns the moment of each instruction, or -1 for barriers,
+// and the instruction which each instruction depends on last, or -1 if none.
+func (c *Circuit) schedule() ([]int, []int) {
+	level := make([]int, c.Size())
+	last := make([]int, c.Size())
+	clevel := make([]int, len(c.cbits))
+	clast := make([]int, len(c.cbits))
+	for i := range last {
+		last[i] = -1
+	}
+	for i := range clast {
+		clast[i] = -1
+	}
+
+	moments := make([]int, len(c.insts))
+	prev := make([]int, len(c.insts))
+
+	for i, inst := range c.insts {
+		qs := inst.Qubits()
+		cs := append([]int{}, inst.Cbits...)
+		if inst.Cond != nil {
+			cs = append(cs, inst.Cond.Cbits...)
+		}
+
+		m, p := 0, -1
+		for _, q := range qs {
+			if level[q] > m || (level[q] == m && p == -1) {
+				m, p = level[q], last[q]
+			}
+		}
+		for _, b := range cs {
+			if clevel[b] > m || (clevel[b] == m && p == -1) {
+				m, p = clevel[b], clast[b]
+			}
+		}
+		prev[i] = p
+
+		if inst.Kind == KindBarrier {
+			// Barriers only synchronize qubits.
+			moments[i] = -1
+			for _, q := range qs {
+				level[q], last[q] = m, p
+			}
+			continue
+		}
+
+		moments[i] = m
+		for _, q := range qs {
+			level[q], last[q] = m+1, i
+		}
+		for _, b := range cs {
+			clevel[b], clast[b] = m+1, i
+		}
+	}
+
+	return moments, prev
+}
+
+// Moments groups recorded instructions into layers, where instructions in each layer act on disjoint qubits.
+// Each instruction is placed in the earliest layer possible. Barriers are not included.
+func (c *Circuit) Moments() [][]Instruction {
+	moments, _ := c.schedule()
+
+	r := make([][]Instruction, 0)
+	for i, m := range moments {
+		if m < 0 {
+			continue
+		}
+		for len(r) <= m {
+			r = append(r, make([]Instruction, 0))
+		}
+		r[m] = append(r[m], c.insts[i].Copy())
+	}
+
+	return r
+}
+
+// Depth returns the number of moments of recorded instructions.
+func (c *Circuit) Depth() int {
+	return len(c.Moments())
+}
+
+// CriticalPath returns the longest chain of dependent instructions, in order.
+// Its length is equal to the depth.
+func (c *Circuit) CriticalPath() []Instruction {
+	moments, prev := c.schedule()
+
+	end, depth := -1, -1
+	for i, m := range moments {
+		if m > depth {
+			end, depth = i, m
+		}
+	}
+
+	r := make([]Instruction, 0, depth+1)
+	for i := end; i >= 0; i = prev[i] {
+		r = append(r, c.insts[i].Copy())
+	}
+
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+
+	return r
+}
+
+// Metrics returns the statistics of recorded instructions.
+func (c *Circuit) Metrics() Metrics {
+	r := Metrics{Counts: make(map[string]int)}
+
+	used := make([]bool, c.Size())
+	tlevel := make([]int, c.Size())
+
+	for _, inst := range c.insts {
+		if inst.Kind == KindBarrier {
+			continue
+		}
+
+		qs := inst.Qubits()
+		r.Size++
+		r.Counts[inst.Name()]++
+		r.CXCount += inst.cxCount()
+		if len(qs) == 2 {
+			r.TwoQubit++
+		}
+
+		t := 0
+		for _, q := range qs {
+			used[q] = true
+			if tlevel[q] > t {
+				t = tlevel[q]
+			}
+		}
+		if inst.isT() {
+			r.TCount++
+			t++
+		}
+		for _, q := range qs {
+			tlevel[q] = t
+		}
+		if t > r.TDepth {
+			r.TDepth = t
+		}
+	}
+
+	for _, u := range used {
+		r.Qubits += boolInt(u)
+	}
+	r.Depth = c.Depth()
+
+	return r
+}
+
+// String implements the Stringer interface.
+func (m Metrics) String() string {
+	return fmt.Sprintf("size: %d, depth: %d, qubits: %d, two qubit: %d, T: %d, T depth: %d, CX: %d",
+		m.Size, m.Depth, m.Qubits, m.TwoQubit, m.TCount, m.TDepth, m.CXCount)
+}
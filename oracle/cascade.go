@@ -0,0 +1,169 @@
+// Package oracle synthesizes classical functions into reversible circuits.
+// Synthesized circuits are cascades of multi-controlled X gates,
+// which can be applied to qsim circuits instead of Circuit.ApplyOracle.
+package oracle
+
+import (
+	"fmt"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/number"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// Gate is a multi-controlled X gate. Target is flipped if every control line is one.
+// If there is no control line, it is just a X gate.
+type Gate struct {
+	Controls []int
+	Target   int
+}
+
+// Cascade is a reversible circuit of multi-controlled X gates on given number of lines.
+type Cascade struct {
+	Lines int
+	Gates []Gate
+}
+
+// NewCascade allocates an empty cascade with given number of lines.
+func NewCascade(lines int) Cascade {
+	if lines <= 0 {
+		panic("Invalid number of lines.")
+	}
+
+	return Cascade{Lines: lines, Gates: make([]Gate, 0)}
+}
+
+// Add appends a gate to the cascade.
+func (c *Cascade) Add(target int, controls ...int) {
+	ctrls := append(make([]int, 0, len(controls)), controls...)
+	lines := append(append(make([]int, 0, len(ctrls)+1), ctrls...), target)
+
+	if number.Min(lines...) < 0 || number.Max(lines...) >= c.Lines {
+		panic("Line index out of range.")
+	}
+
+	if slice.HasDuplicate(lines) {
+		panic("Duplicate lines.")
+	}
+
+	c.Gates = append(c.Gates, Gate{Controls: ctrls, Target: target})
+}
+
+// Len returns the number of gates in the cascade.
+func (c Cascade) Len() int {
+	return len(c.Gates)
+}
+
+// MaxControls returns the largest number of controls in a gate.
+func (c Cascade) MaxControls() int {
+	r := 0
+	for _, g := range c.Gates {
+		if len(g.Controls) > r {
+			r = len(g.Controls)
+		}
+	}
+
+	return r
+}
+
+// Eval evaluates the cascade on classical input x.
+func (c Cascade) Eval(x int) int {
+	for _, g := range c.Gates {
+		fire := true
+		for _, q := range g.Controls {
+			if (x>>q)&1 == 0 {
+				fire = false
+				break
+			}
+		}
+
+		if fire {
+			x ^= 1 << g.Target
+		}
+	}
+
+	return x
+}
+
+// Inverse returns the inverse of the cascade.
+func (c Cascade) Inverse() Cascade {
+	r := NewCascade(c.Lines)
+	for i := len(c.Gates) - 1; i >= 0; i-- {
+		r.Add(c.Gates[i].Target, c.Gates[i].Controls...)
+	}
+
+	return r
+}
+
+// Append returns a cascade of c followed by o.
+func (c Cascade) Append(o Cascade) Cascade {
+	r := NewCascade(number.Max(c.Lines, o.Lines))
+	for _, g := range append(append([]Gate{}, c.Gates...), o.Gates...) {
+		r.Add(g.Target, g.Controls...)
+	}
+
+	return r
+}
+
+// Apply applies the cascade to circuit, where ith line is mapped to lines[i].
+func (c Cascade) Apply(circ *qsim.Circuit, lines []int) {
+	if len(lines) != c.Lines {
+		panic("Number of registers does not match lines.")
+	}
+
+	for _, g := range c.Gates {
+		if len(g.Controls) == 0 {
+			circ.X(lines[g.Target])
+			continue
+		}
+
+		ctrls := make([]int, len(g.Controls))
+		for i, q := range g.Controls {
+			ctrls[i] = lines[q]
+		}
+		circ.Control(qsim.X(), ctrls, []int{lines[g.Target]})
+	}
+}
+
+// Decompose returns an equivalent cascade using gates with at most two controls.
+// Gates with k > 2 controls are decomposed into 2(k-2)+1 Toffoli gates using k-2 clean ancilla lines,
+// which are appended after the original lines and restored after each gate.
+func (c Cascade) Decompose() Cascade {
+	nanc := number.Max(c.MaxControls()-2, 0)
+	r := NewCascade(c.Lines + nanc)
+
+	for _, g := range c.Gates {
+		k := len(g.Controls)
+		if k <= 2 {
+			r.Add(g.Target, g.Controls...)
+			continue
+		}
+
+		// Compute AND of controls into ancillas, one by one.
+		chain := make([]Gate, 0, k-2)
+		chain = append(chain, Gate{Controls: []int{g.Controls[0], g.Controls[1]}, Target: c.Lines})
+		for i := 2; i < k-1; i++ {
+			chain = append(chain, Gate{Controls: []int{g.Controls[i], c.Lines + i - 2}, Target: c.Lines + i - 1})
+		}
+
+		for _, t := range chain {
+			r.Add(t.Target, t.Controls...)
+		}
+		r.Add(g.Target, g.Controls[k-1], c.Lines+k-3)
+		for i := len(chain) - 1; i >= 0; i-- {
+			r.Add(chain[i].Target, chain[i].Controls...)
+		}
+	}
+
+	return r
+}
+
+// String implements the Stringer interface.
+func (c Cascade) String() string {
+	r := ""
+	for _, g := range c.Gates {
+		r += fmt.Sprintf("MCX(%v -> %d)\n", g.Controls, g.Target)
+	}
+
+	return r
+}
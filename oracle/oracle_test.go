@@ -0,0 +1,100 @@
+package oracle_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/algorithms/deutchjozsa"
+	"github.com/sp301415/qsim/math/number"
+	"github.com/sp301415/qsim/oracle"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+func TestESOP(t *testing.T) {
+	n, m := 4, 3
+	f := func(x int) int { return (x*x + 3) % 7 }
+	c := oracle.Synthesize(f, n, m)
+
+	for x := 0; x < 1<<n; x++ {
+		for y := 0; y < 1<<m; y++ {
+			if c.Eval(x|y<<n) != x|(y^f(x))<<n {
+				t.Fatalf("f(%d)", x)
+			}
+		}
+	}
+}
+
+func TestESOPCircuit(t *testing.T) {
+	n := 5
+	iregs := slice.Range(0, n)
+	oregs := []int{n}
+
+	c1 := qsim.NewCircuit(n + 1)
+	c2 := qsim.NewCircuit(n + 1)
+
+	c1.H(iregs...)
+	c2.H(iregs...)
+
+	c1.ApplyOracle(deutchjozsa.BalancedFunc, iregs, oregs)
+	oracle.Synthesize(deutchjozsa.BalancedFunc, n, 1).Apply(c2, append(iregs, oregs...))
+
+	if !c1.State().Equals(c2.State()) {
+		t.Fail()
+	}
+}
+
+func TestTBS(t *testing.T) {
+	n := 4
+	perm := rand.Perm(1 << n)
+	c := oracle.TBS(oracle.NewTruthTable(n, n, perm))
+
+	for x := 0; x < 1<<n; x++ {
+		if c.Eval(x) != perm[x] {
+			t.Fatalf("f(%d)", x)
+		}
+	}
+
+	ci := c.Inverse()
+	for x := 0; x < 1<<n; x++ {
+		if ci.Eval(perm[x]) != x {
+			t.Fatalf("f^-1(%d)", perm[x])
+		}
+	}
+}
+
+func TestDecompose(t *testing.T) {
+	n := 5
+	c := oracle.Synthesize(func(x int) int { return number.PowMod(3, x, 31) }, n, n)
+	d := c.Decompose()
+
+	if d.MaxControls() > 2 {
+		t.Fail()
+	}
+
+	for x := 0; x < 1<<(2*n); x++ {
+		if d.Eval(x) != c.Eval(x) {
+			t.Fatalf("f(%d)", x)
+		}
+	}
+}
+
+func TestExpr(t *testing.T) {
+	tt := oracle.FromExpr("a & ~(b | c) ^ 1", "c", "b", "a")
+
+	for x := 0; x < 8; x++ {
+		a, b, c := (x>>2)&1 == 1, (x>>1)&1 == 1, x&1 == 1
+		want := 0
+		if (a && !(b || c)) != true {
+			want = 1
+		}
+
+		if tt.Out[x] != want {
+			t.Fatalf("f(%d)", x)
+		}
+	}
+
+	if oracle.FromExpr("x1 ^ x0").Out[0b10] != 1 {
+		t.Fail()
+	}
+}
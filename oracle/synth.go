@@ -0,0 +1,172 @@
+package oracle
+
+import (
+	"math/bits"
+)
+
+// Maximum number of inputs to search every polarity in ESOP.
+const maxPolaritySearch = 10
+
+// reedMuller returns the positive polarity Reed-Muller coefficients of one bit function f on n bits.
+// f(x) = XOR of monomials S where r[S] = 1, and S is the set of variables in the monomial.
+func reedMuller(f []int) []int {
+	r := append([]int{}, f...)
+	for i := 1; i < len(r); i <<= 1 {
+		for x := range r {
+			if x&i != 0 {
+				r[x] ^= r[x^i]
+			}
+		}
+	}
+
+	return r
+}
+
+// fprm returns the fixed polarity Reed-Muller coefficients of f with polarity p,
+// which are the positive polarity coefficients of f(x^p).
+func fprm(f []int, p int) []int {
+	g := make([]int, len(f))
+	for x := range g {
+		g[x] = f[x^p]
+	}
+
+	return reedMuller(g)
+}
+
+// cost returns the cost of an ESOP, which is the number of terms and the total number of controls.
+func cost(r []int) (int, int) {
+	terms, ctrls := 0, 0
+	for s, a := range r {
+		if a == 1 {
+			terms++
+			ctrls += bits.OnesCount(uint(s))
+		}
+	}
+
+	return terms, ctrls
+}
+
+// ESOP synthesizes tt into a cascade mapping |x>|y> -> |x>|y^f(x)>.
+// Lines 0 to N-1 are inputs, and lines N to N+M-1 are outputs.
+// Each output bit is written as a fixed polarity Reed-Muller expression,
+// which is an exclusive sum of products. Each product becomes a multi-controlled X gate,
+// and negative polarity inputs are conjugated by X gates.
+func ESOP(tt TruthTable) Cascade {
+	c := NewCascade(tt.N + tt.M)
+	size := 1 << tt.N
+
+	// Current polarity of input lines.
+	pol := 0
+
+	for j := 0; j < tt.M; j++ {
+		f := make([]int, size)
+		for x, y := range tt.Out {
+			f[x] = (y >> j) & 1
+		}
+
+		// Find the best polarity.
+		best, bestr := 0, reedMuller(f)
+		if tt.N <= maxPolaritySearch {
+			bt, bn := cost(bestr)
+			for p := 1; p < size; p++ {
+				r := fprm(f, p)
+				t, n := cost(r)
+				if t < bt || (t == bt && n < bn) {
+					best, bestr, bt, bn = p, r, t, n
+				}
+			}
+		}
+
+		// f(x) = g(x^p), so negate inputs whose polarity differ.
+		for i := 0; i < tt.N; i++ {
+			if ((pol^best)>>i)&1 == 1 {
+				c.Add(i)
+			}
+		}
+		pol = best
+
+		for s, a := range bestr {
+			if a == 0 {
+				continue
+			}
+
+			ctrls := make([]int, 0, bits.OnesCount(uint(s)))
+			for i := 0; i < tt.N; i++ {
+				if (s>>i)&1 == 1 {
+					ctrls = append(ctrls, i)
+				}
+			}
+			c.Add(tt.N+j, ctrls...)
+		}
+	}
+
+	for i := 0; i < tt.N; i++ {
+		if (pol>>i)&1 == 1 {
+			c.Add(i)
+		}
+	}
+
+	return c
+}
+
+// TBS synthesizes a permutation tt into a cascade mapping |x> -> |f(x)> in place,
+// using transformation based synthesis of Miller, Maslov and Dueck. No ancillas are used.
+func TBS(tt TruthTable) Cascade {
+	if !tt.IsPermutation() {
+		panic("Truth table is not a permutation.")
+	}
+
+	f := append([]int{}, tt.Out...)
+	gates := make([]Gate, 0)
+
+	// apply applies gate to the output side of f.
+	apply := func(target, ctrlmask int) {
+		for x, y := range f {
+			if y&ctrlmask == ctrlmask {
+				f[x] = y ^ (1 << target)
+			}
+		}
+
+		ctrls := make([]int, 0)
+		for i := 0; i < tt.N; i++ {
+			if (ctrlmask>>i)&1 == 1 {
+				ctrls = append(ctrls, i)
+			}
+		}
+		gates = append(gates, Gate{Controls: ctrls, Target: target})
+	}
+
+	for x := range f {
+		if f[x] == x {
+			continue
+		}
+
+		// Set bits which are 1 in x but 0 in f(x), controlled by ones in f(x).
+		for i := 0; i < tt.N; i++ {
+			if (x>>i)&1 == 1 && (f[x]>>i)&1 == 0 {
+				apply(i, f[x])
+			}
+		}
+
+		// Clear bits which are 0 in x but 1 in f(x), controlled by ones in x.
+		for i := 0; i < tt.N; i++ {
+			if (x>>i)&1 == 0 && (f[x]>>i)&1 == 1 {
+				apply(i, x)
+			}
+		}
+	}
+
+	// Gates were applied after f to get identity, so f is the reverse of them.
+	c := NewCascade(tt.N)
+	for i := len(gates) - 1; i >= 0; i-- {
+		c.Add(gates[i].Target, gates[i].Controls...)
+	}
+
+	return c
+}
+
+// Synthesize synthesizes f from n bits to m bits into a cascade mapping |x>|y> -> |x>|y^f(x)>,
+// which is equivalent to Circuit.ApplyOracle(f, iregs, oregs) applied with lines iregs followed by oregs.
+func Synthesize(f func(int) int, n, m int) Cascade {
+	return ESOP(FromFunc(f, n, m))
+}
@@ -0,0 +1,220 @@
+package oracle
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// TruthTable represents a classical function from N bits to M bits.
+// Out[x] is the output of input x.
+type TruthTable struct {
+	N   int
+	M   int
+	Out []int
+}
+
+// NewTruthTable allocates new truth table from given outputs.
+// len(out) should be 2^n, and every output should fit in m bits.
+func NewTruthTable(n, m int, out []int) TruthTable {
+	if n <= 0 || m <= 0 || len(out) != 1<<n {
+		panic("Invalid truth table size.")
+	}
+
+	for _, y := range out {
+		if y < 0 || y >= 1<<m {
+			panic("Output does not fit in m bits.")
+		}
+	}
+
+	return TruthTable{N: n, M: m, Out: append([]int{}, out...)}
+}
+
+// FromFunc evaluates f on every n bit input, and returns its truth table.
+// Outputs are truncated to m bits, same as Circuit.ApplyOracle.
+func FromFunc(f func(int) int, n, m int) TruthTable {
+	out := make([]int, 1<<n)
+	for x := range out {
+		out[x] = f(x) & ((1 << m) - 1)
+	}
+
+	return NewTruthTable(n, m, out)
+}
+
+// Func returns the function represented by tt.
+func (tt TruthTable) Func() func(int) int {
+	return func(x int) int { return tt.Out[x] }
+}
+
+// IsPermutation checks if tt is a bijection on N bits.
+func (tt TruthTable) IsPermutation() bool {
+	if tt.N != tt.M {
+		return false
+	}
+
+	seen := make([]bool, len(tt.Out))
+	for _, y := range tt.Out {
+		if seen[y] {
+			return false
+		}
+		seen[y] = true
+	}
+
+	return true
+}
+
+// Boolean expressions.
+
+// FromExpr parses a Boolean expression and returns its one bit truth table.
+// Expressions consist of variables, constants 0 and 1, parenthesis and operators
+// ~ or ! (NOT), & (AND), ^ (XOR) and | (OR), in order of precedence.
+// vars gives the order of variables, where ith variable is the ith input bit.
+// If vars is empty, variables are sorted by name.
+func FromExpr(expr string, vars ...string) TruthTable {
+	p := &parser{src: expr}
+	p.tokenize()
+
+	if len(vars) == 0 {
+		set := make(map[string]struct{})
+		for _, t := range p.tokens {
+			if isIdent(t) {
+				set[t] = struct{}{}
+			}
+		}
+		for v := range set {
+			vars = append(vars, v)
+		}
+		sort.Strings(vars)
+	}
+
+	if len(vars) == 0 {
+		panic("Expression has no variables.")
+	}
+
+	p.vars = make(map[string]int)
+	for i, v := range vars {
+		p.vars[v] = i
+	}
+
+	e := p.parseOr()
+	if p.pos != len(p.tokens) {
+		panic("Invalid expression: unexpected " + p.tokens[p.pos])
+	}
+
+	out := make([]int, 1<<len(vars))
+	for x := range out {
+		if e(x) {
+			out[x] = 1
+		}
+	}
+
+	return NewTruthTable(len(vars), 1, out)
+}
+
+// parser is a recursive descent parser for Boolean expressions.
+type parser struct {
+	src    string
+	tokens []string
+	pos    int
+	vars   map[string]int
+}
+
+func isIdent(t string) bool {
+	r := rune(t[0])
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func (p *parser) tokenize() {
+	s := []rune(p.src)
+	for i := 0; i < len(s); {
+		switch {
+		case unicode.IsSpace(s[i]):
+			i++
+		case strings.ContainsRune("~!&^|()01", s[i]):
+			p.tokens = append(p.tokens, string(s[i]))
+			i++
+		case unicode.IsLetter(s[i]) || s[i] == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(s[j]) || unicode.IsDigit(s[j]) || s[j] == '_') {
+				j++
+			}
+			p.tokens = append(p.tokens, string(s[i:j]))
+			i = j
+		default:
+			panic("Invalid expression: unexpected " + string(s[i]))
+		}
+	}
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	if t == "" {
+		panic("Invalid expression: unexpected end.")
+	}
+	p.pos++
+	return t
+}
+
+func (p *parser) parseOr() func(int) bool {
+	l := p.parseXor()
+	for p.peek() == "|" {
+		p.next()
+		a, b := l, p.parseXor()
+		l = func(x int) bool { return a(x) || b(x) }
+	}
+	return l
+}
+
+func (p *parser) parseXor() func(int) bool {
+	l := p.parseAnd()
+	for p.peek() == "^" {
+		p.next()
+		a, b := l, p.parseAnd()
+		l = func(x int) bool { return a(x) != b(x) }
+	}
+	return l
+}
+
+func (p *parser) parseAnd() func(int) bool {
+	l := p.parseUnary()
+	for p.peek() == "&" {
+		p.next()
+		a, b := l, p.parseUnary()
+		l = func(x int) bool { return a(x) && b(x) }
+	}
+	return l
+}
+
+func (p *parser) parseUnary() func(int) bool {
+	t := p.next()
+	switch {
+	case t == "~" || t == "!":
+		a := p.parseUnary()
+		return func(x int) bool { return !a(x) }
+	case t == "(":
+		a := p.parseOr()
+		if p.next() != ")" {
+			panic("Invalid expression: unmatched parenthesis.")
+		}
+		return a
+	case t == "0":
+		return func(int) bool { return false }
+	case t == "1":
+		return func(int) bool { return true }
+	case isIdent(t):
+		i, ok := p.vars[t]
+		if !ok {
+			panic("Invalid expression: unknown variable " + t)
+		}
+		return func(x int) bool { return (x>>i)&1 == 1 }
+	}
+
+	panic("Invalid expression: unexpected " + t)
+}
@@ -0,0 +1,91 @@
+package qsim
+
+import (
+	"runtime"
+	"sync"
+)
+
+// task is a chunk of a parallel job, applying f to [start, end).
+type task struct {
+	f          func(start, end int)
+	start, end int
+}
+
+// pool is a set of persistent goroutines running parallel kernels.
+type pool struct {
+	size  int
+	tasks chan task
+	wg    sync.WaitGroup
+}
+
+// newPool starts a pool of size goroutines.
+func newPool(size int) *pool {
+	p := &pool{size: size, tasks: make(chan task, size)}
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// work runs tasks until the pool is closed.
+func (p *pool) work() {
+	for t := range p.tasks {
+		t.f(t.start, t.end)
+		p.wg.Done()
+	}
+}
+
+// run splits [0, jobsize) into chunks, and waits until f is applied to every chunk.
+func (p *pool) run(jobsize int, f func(start, end int)) {
+	idx := chunks(jobsize, p.size)
+
+	p.wg.Add(p.size)
+	for n := 0; n < p.size; n++ {
+		p.tasks <- task{f: f, start: idx[n], end: idx[n+1]}
+	}
+	p.wg.Wait()
+}
+
+// close stops the goroutines of the pool.
+func (p *pool) close() {
+	close(p.tasks)
+}
+
+// chunks splits [0, jobsize) into n chunks of almost equal size.
+// Chunk i is [idx[i], idx[i+1]).
+func chunks(jobsize, n int) []int {
+	idx := make([]int, n+1)
+	for i := 0; i <= n; i++ {
+		idx[i] = i * jobsize / n
+	}
+
+	return idx
+}
+
+// parallel applies f to chunks of [0, jobsize), using GOROUTINE_CNT goroutines of the worker pool.
+// The pool is started on the first use, and restarted if GOROUTINE_CNT changes.
+func (c *Circuit) parallel(jobsize int, f func(start, end int)) {
+	if c.Option.GOROUTINE_CNT <= 1 {
+		f(0, jobsize)
+		return
+	}
+
+	if c.workers == nil || c.workers.size != c.Option.GOROUTINE_CNT {
+		c.Close()
+		c.workers = newPool(c.Option.GOROUTINE_CNT)
+		runtime.SetFinalizer(c, (*Circuit).Close)
+	}
+
+	c.workers.run(jobsize, f)
+}
+
+// Close stops the worker goroutines of this circuit.
+// The circuit can still be used after Close, and the workers are started again when needed.
+func (c *Circuit) Close() {
+	if c.workers != nil {
+		c.workers.close()
+		c.workers = nil
+		runtime.SetFinalizer(c, nil)
+	}
+}
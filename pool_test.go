@@ -0,0 +1,51 @@
+package qsim
+
+import (
+	"sync"
+	"testing"
+)
+
+// spawnParallel applies f to chunks of [0, jobsize), spawning cnt goroutines on every call.
+// This is how parallel kernels ran before the worker pool, and is kept as a baseline.
+func spawnParallel(cnt, jobsize int, f func(start, end int)) {
+	idx := chunks(jobsize, cnt)
+
+	var wg sync.WaitGroup
+	wg.Add(cnt)
+	for n := 0; n < cnt; n++ {
+		go func(start, end int) {
+			f(start, end)
+			wg.Done()
+		}(idx[n], idx[n+1])
+	}
+	wg.Wait()
+}
+
+// benchmarkParallel runs 2000 small jobs on 4 goroutines through run, where the per-call overhead dominates.
+func benchmarkParallel(b *testing.B, run func(jobsize int, f func(start, end int))) {
+	data := make([]complex128, 1<<8)
+	f := func(start, end int) {
+		for i := start; i < end; i++ {
+			data[i] *= 1i
+		}
+	}
+
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 2000; j++ {
+			run(len(data), f)
+		}
+	}
+}
+
+func BenchmarkParallelPool(b *testing.B) {
+	p := newPool(4)
+	defer p.close()
+
+	benchmarkParallel(b, p.run)
+}
+
+func BenchmarkParallelSpawn(b *testing.B) {
+	benchmarkParallel(b, func(jobsize int, f func(start, end int)) {
+		spawnParallel(4, jobsize, f)
+	})
+}
@@ -0,0 +1,148 @@
+package qsim
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// QuantumRegister is a list of qubit indices, where the first qubit is the LSB.
+// Since it is a slice of ints, it can be directly passed to gate methods, like c.H(reg...).
+type QuantumRegister []int
+
+// ClassicalRegister is a list of classical bit indices, where the first bit is the LSB.
+type ClassicalRegister []int
+
+// Len returns the number of qubits in the register.
+func (r QuantumRegister) Len() int {
+	return len(r)
+}
+
+// Len returns the number of bits in the register.
+func (r ClassicalRegister) Len() int {
+	return len(r)
+}
+
+// AddRegister appends n qubits initialized to |0> to the circuit,
+// and returns them as a register with given name.
+// Existing state is kept, and new qubits are placed after existing qubits.
+func (c *Circuit) AddRegister(name string, n int) QuantumRegister {
+	if n <= 0 {
+		panic("Invalid number of qubits.")
+	}
+
+	c.Option.checkQubits(c.Size() + n)
+
+	if c.Register(name) != nil {
+		panic("Duplicate register name.")
+	}
+
+	if c.cond != nil {
+		panic("Cannot add registers inside CIf.")
+	}
+
+	// |0>^n (x) |state>, so previous amplitudes keep their indices.
+	c.flush()
+	if c.state != nil {
+		c.state.grow(n)
+	}
+
+	reg := QuantumRegister(slice.Range(c.Size(), c.Size()+n))
+	c.size += n
+	c.qregs = append(c.qregs, reg)
+	c.qnames = append(c.qnames, name)
+
+	return reg
+}
+
+// AddClassicalRegister adds n classical bits initialized to 0,
+// and returns them as a register with given name.
+func (c *Circuit) AddClassicalRegister(name string, n int) ClassicalRegister {
+	if c.ClassicalRegister(name) != nil {
+		panic("Duplicate register name.")
+	}
+
+	reg := ClassicalRegister(c.AddCbits(n))
+	c.cregs = append(c.cregs, reg)
+	c.cnames = append(c.cnames, name)
+
+	return reg
+}
+
+// Register returns the quantum register with given name, or nil if not found.
+func (c *Circuit) Register(name string) QuantumRegister {
+	for i, n := range c.qnames {
+		if n == name {
+			return c.qregs[i]
+		}
+	}
+
+	return nil
+}
+
+// ClassicalRegister returns the classical register with given name, or nil if not found.
+func (c *Circuit) ClassicalRegister(name string) ClassicalRegister {
+	for i, n := range c.cnames {
+		if n == name {
+			return c.cregs[i]
+		}
+	}
+
+	return nil
+}
+
+// RegisterNames returns the names of quantum registers, in order of allocation.
+func (c *Circuit) RegisterNames() []string {
+	return append([]string{}, c.qnames...)
+}
+
+// ClassicalRegisterNames returns the names of classical registers, in order of allocation.
+func (c *Circuit) ClassicalRegisterNames() []string {
+	return append([]string{}, c.cnames...)
+}
+
+// Value returns the current value of classical register reg.
+func (c *Circuit) Value(reg ClassicalRegister) int {
+	return c.CbitsValue(reg...)
+}
+
+// Values returns the current values of every classical register, keyed by name.
+func (c *Circuit) Values() map[string]int {
+	r := make(map[string]int, len(c.cregs))
+	for i, reg := range c.cregs {
+		r[c.cnames[i]] = c.Value(reg)
+	}
+
+	return r
+}
+
+// formatValues formats the values of classical registers, like "a=01 b=1".
+func (c *Circuit) formatValues() string {
+	vals := make([]string, len(c.cregs))
+	for i, reg := range c.cregs {
+		vals[i] = fmt.Sprintf("%s=%0*b", c.cnames[i], reg.Len(), c.Value(reg))
+	}
+
+	return strings.Join(vals, " ")
+}
+
+// RegisterCounts runs the circuit shots times, and returns the counts of classical register values.
+// Keys are formatted as "name=bits" for each classical register in order of allocation,
+// separated by spaces, like "a=01 b=1". Bits are written with the MSB first.
+// State of c is not changed.
+func (c *Circuit) RegisterCounts(shots int) map[string]int {
+	counts := c.Counts(shots)
+
+	r := make(map[string]int, len(counts))
+	saved := append([]int{}, c.cbits...)
+	for k := range counts {
+		for i := range c.cbits {
+			c.cbits[i] = (k >> i) & 1
+		}
+		r[c.formatValues()] += counts[k]
+	}
+	copy(c.cbits, saved)
+
+	return r
+}
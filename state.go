@@ -0,0 +1,110 @@
+package qsim
+
+import (
+	"github.com/sp301415/qsim/math/vec"
+)
+
+// amplitude is the type of amplitudes of state vectors.
+type amplitude interface {
+	complex64 | complex128
+}
+
+// vector is a state vector with amplitudes of type T.
+//
+// With complex64, each real and imaginary part has a 24 bit mantissa, so the unit roundoff is u = 2^-24 ~ 6e-8.
+// Gate entries are rounded once when the gate is applied, and each new amplitude of a k qubit gate is a sum of
+// at most 2^k products, so one gate adds an error of at most about 2^k * u to the state in 2-norm.
+// Since gates are unitary, errors are not amplified, and the error after g gates is bounded by g * 2^k * u.
+// Rounding errors are mostly uncorrelated, so the observed error grows like sqrt(g) * u,
+// which is around 1e-6 after a thousand one or two qubit gates. The norm drifts by the same order.
+// Measurement probabilities are accumulated in float64, so sampling adds no further error.
+// Angles of rotations below u are lost, which matters for the controlled phases of QFT on more than 24 qubits.
+type vector[T amplitude] struct {
+	data []T // Amplitudes.
+	temp []T // Used for some apply functions. nil until needed, if allocated lazily.
+}
+
+// stateVector is a state vector in single or double precision.
+type stateVector interface {
+	qubit() Qubit
+	grow(n int)
+
+	applyGate(c *Circuit, op Gate, iregs []int)
+	controlGate(c *Circuit, op Gate, cregs, iregs []int)
+	applyOracle(c *Circuit, oracle func(int) int, iregs, oregs []int)
+	checkOracle(c *Circuit, oracle func(int) int, iregs, oregs []int) ([]int, error)
+	applyPhaseOracle(c *Circuit, oracle func(int) bool, iregs []int)
+	measure(c *Circuit, iregs, cregs []int) int
+	hadamard(c *Circuit, iregs []int)
+	qft(c *Circuit, iregs []int, inverse bool)
+}
+
+// newState returns the basis state |n> of given size, with precision and temp allocation of opt.
+// Unlike NewBit, size 0 is allowed.
+func newState(n, size int, opt Options) stateVector {
+	if n < 0 || n >= 1<<size {
+		panic("Size too small.")
+	}
+
+	if opt.SINGLE_PRECISION {
+		return newVector[complex64](n, size, opt.LAZY_TEMP)
+	}
+	return newVector[complex128](n, size, opt.LAZY_TEMP)
+}
+
+// newVector returns the basis state |n> of given size. If lazy is true, temp is allocated when needed.
+func newVector[T amplitude](n, size int, lazy bool) *vector[T] {
+	v := &vector[T]{data: make([]T, 1<<size)}
+	v.data[n] = 1
+	if !lazy {
+		v.temp = make([]T, 1<<size)
+	}
+
+	return v
+}
+
+// qubit returns the copy of the state as a Qubit.
+func (v *vector[T]) qubit() Qubit {
+	r := vec.NewVec(len(v.data))
+	for i, a := range v.data {
+		r[i] = complex128(a)
+	}
+
+	return NewQubit(r)
+}
+
+// grow appends n qubits in |0> after existing qubits, as |0>^n (x) |state>.
+func (v *vector[T]) grow(n int) {
+	data := make([]T, len(v.data)<<n)
+	copy(data, v.data)
+
+	v.data = data
+	if v.temp != nil {
+		v.temp = make([]T, len(data))
+	}
+}
+
+// cleartemp clears temp, allocating it if needed.
+func (v *vector[T]) cleartemp() {
+	if len(v.temp) != len(v.data) {
+		v.temp = make([]T, len(v.data))
+		return
+	}
+
+	for i := range v.temp {
+		v.temp[i] = 0
+	}
+}
+
+// matrix returns entries of op as type T.
+func matrix[T amplitude](op Gate) [][]T {
+	m := make([][]T, len(op.data))
+	for i, row := range op.data {
+		m[i] = make([]T, len(row))
+		for j, a := range row {
+			m[i][j] = T(a)
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,452 @@
+package synth
+
+import (
+	"math"
+	"math/cmplx"
+	"strings"
+	"sync"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
+)
+
+// CliffordT is a sequence of one qubit Clifford+T gates, in the order of application.
+// Each gate is one of "H", "S", "Sdg", "T", "Tdg" and "Z".
+type CliffordT []string
+
+// su2 is a 2x2 matrix [[a, b], [c, d]], stored as [a, b, c, d].
+type su2 [4]complex128
+
+// mul returns m * n.
+func (m su2) mul(n su2) su2 {
+	return su2{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+	}
+}
+
+// dagger returns the conjugate transpose of m.
+func (m su2) dagger() su2 {
+	return su2{cmplx.Conj(m[0]), cmplx.Conj(m[2]), cmplx.Conj(m[1]), cmplx.Conj(m[3])}
+}
+
+// overlap returns |tr(m^dagger n)| / 2.
+func (m su2) overlap(n su2) float64 {
+	t := 0i
+	for i := range m {
+		t += cmplx.Conj(m[i]) * n[i]
+	}
+	return cmplx.Abs(t) / 2
+}
+
+// special returns m up to the global phase, with determinant 1 and nonnegative real trace.
+func (m su2) special() su2 {
+	p := 1 / cmplx.Sqrt(m[0]*m[3]-m[1]*m[2])
+	if real((m[0]+m[3])*p) < 0 {
+		p = -p
+	}
+	for i := range m {
+		m[i] *= p
+	}
+
+	return m
+}
+
+// toSU2 converts one qubit gate g to su2, with determinant 1 and nonnegative real trace.
+func toSU2(g qsim.Gate) su2 {
+	checkOne(g)
+	return su2{g.At(0, 0), g.At(0, 1), g.At(1, 0), g.At(1, 1)}.special()
+}
+
+// distance returns sqrt(1 - |tr(m^dagger n)|/2), which ignores the global phase.
+func distance(m, n su2) float64 {
+	return math.Sqrt(math.Max(0, 1-m.overlap(n)))
+}
+
+// Distance returns the distance between one qubit gates a and b ignoring the global phase,
+// which is sqrt(1 - |tr(a^dagger b)|/2).
+func Distance(a, b qsim.Gate) float64 {
+	return distance(toSU2(a), toSU2(b))
+}
+
+// cliffordTGates are matrices of Clifford+T gates.
+var cliffordTGates = map[string]su2{
+	"H":   {complex(1/math.Sqrt2, 0), complex(1/math.Sqrt2, 0), complex(1/math.Sqrt2, 0), complex(-1/math.Sqrt2, 0)},
+	"S":   {1, 0, 0, 1i},
+	"Sdg": {1, 0, 0, -1i},
+	"T":   {1, 0, 0, cmplx.Rect(1, math.Pi/4)},
+	"Tdg": {1, 0, 0, cmplx.Rect(1, -math.Pi/4)},
+	"Z":   {1, 0, 0, -1},
+}
+
+// matrix returns the matrix of s, including the global phase.
+func (s CliffordT) matrix() su2 {
+	m := su2{1, 0, 0, 1}
+	for _, g := range s {
+		n, ok := cliffordTGates[g]
+		if !ok {
+			panic("Invalid Clifford+T gate.")
+		}
+		m = n.mul(m)
+	}
+
+	return m
+}
+
+// Gate returns the gate of s.
+func (s CliffordT) Gate() qsim.Gate {
+	m := s.matrix()
+	return qsim.NewGate(mat.NewMatVars(2, m[0], m[1], m[2], m[3]))
+}
+
+// Circuit returns the one qubit circuit of s.
+func (s CliffordT) Circuit() *qsim.Circuit {
+	c := qsim.NewCircuit(1)
+	s.apply(c, 0)
+
+	return c
+}
+
+// apply applies s to qubit i of c.
+func (s CliffordT) apply(c *qsim.Circuit, i int) {
+	for _, g := range s {
+		switch g {
+		case "H":
+			c.H(i)
+		case "S":
+			c.S(i)
+		case "Sdg":
+			c.Apply(qsim.S().Dagger(), i)
+		case "T":
+			c.T(i)
+		case "Tdg":
+			c.Apply(qsim.T().Dagger(), i)
+		case "Z":
+			c.Z(i)
+		default:
+			panic("Invalid Clifford+T gate.")
+		}
+	}
+}
+
+// TCount returns the number of T and Tdg gates in s.
+func (s CliffordT) TCount() int {
+	n := 0
+	for _, g := range s {
+		if g == "T" || g == "Tdg" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Dagger returns the inverse of s.
+func (s CliffordT) Dagger() CliffordT {
+	r := make(CliffordT, len(s))
+	for i, g := range s {
+		switch g {
+		case "S", "T":
+			g += "dg"
+		case "Sdg", "Tdg":
+			g = strings.TrimSuffix(g, "dg")
+		}
+		r[len(s)-1-i] = g
+	}
+
+	return r
+}
+
+// String implements the Stringer interface.
+func (s CliffordT) String() string {
+	return strings.Join(s, " ")
+}
+
+// diagonalPowers are powers of T for diagonal gates.
+var diagonalPowers = map[string]int{"T": 1, "S": 2, "Z": 4, "Sdg": 6, "Tdg": 7}
+
+// diagonalGates are gates for T^k, with at most one T or Tdg.
+var diagonalGates = [8]CliffordT{{}, {"T"}, {"S"}, {"S", "T"}, {"Z"}, {"Z", "T"}, {"Sdg"}, {"Tdg"}}
+
+// simplify cancels adjacent H gates and merges adjacent diagonal gates, so that
+// there is at most one T or Tdg gate between two H gates.
+func (s CliffordT) simplify() CliffordT {
+	// Stack of -1 for H, and powers of T for diagonal gates.
+	stack := make([]int, 0, len(s))
+	for _, g := range s {
+		top := len(stack) - 1
+
+		if g == "H" {
+			if top >= 0 && stack[top] == -1 {
+				stack = stack[:top]
+			} else {
+				stack = append(stack, -1)
+			}
+			continue
+		}
+
+		k := diagonalPowers[g]
+		if top >= 0 && stack[top] != -1 {
+			k = (k + stack[top]) % 8
+			stack = stack[:top]
+		}
+		if k != 0 {
+			stack = append(stack, k)
+		}
+	}
+
+	r := CliffordT{}
+	for _, k := range stack {
+		if k == -1 {
+			r = append(r, "H")
+		} else {
+			r = append(r, diagonalGates[k]...)
+		}
+	}
+
+	return r
+}
+
+// netSize is the number of distinct gates in the Solovay-Kitaev base net.
+const netSize = 20000
+
+var (
+	netOnce  sync.Once
+	netMats  []su2
+	netWords []CliffordT
+)
+
+// net returns the Solovay-Kitaev base net, which is the set of shortest Clifford+T sequences
+// for distinct gates up to the global phase, found by breadth first search.
+func net() ([]su2, []CliffordT) {
+	netOnce.Do(func() {
+		type key [8]int64
+		keyOf := func(m su2) key {
+			// Fix the global phase by the first nonzero entry.
+			p := m[0]
+			if cmplx.Abs(p) < 1e-6 {
+				p = m[1]
+			}
+			p = cmplx.Conj(p) / complex(cmplx.Abs(p), 0)
+
+			var k key
+			for i, x := range m {
+				x *= p
+				k[2*i] = int64(math.Round(real(x) * 1e6))
+				k[2*i+1] = int64(math.Round(imag(x) * 1e6))
+			}
+			return k
+		}
+
+		gens := []string{"H", "S", "Sdg", "T", "Tdg"}
+		seen := map[key]bool{keyOf(su2{1, 0, 0, 1}): true}
+		netMats, netWords = []su2{{1, 0, 0, 1}}, []CliffordT{{}}
+
+		for i := 0; i < len(netMats) && len(netMats) < netSize; i++ {
+			for _, g := range gens {
+				m := cliffordTGates[g].mul(netMats[i])
+				k := keyOf(m)
+				if seen[k] {
+					continue
+				}
+				seen[k] = true
+
+				w := make(CliffordT, len(netWords[i])+1)
+				copy(w, netWords[i])
+				w[len(w)-1] = g
+
+				netMats = append(netMats, m)
+				netWords = append(netWords, w)
+			}
+		}
+	})
+
+	return netMats, netWords
+}
+
+// nearest returns the sequence in the base net nearest to m.
+func nearest(m su2) CliffordT {
+	mats, words := net()
+
+	best, bi := -1.0, 0
+	for i, n := range mats {
+		if o := m.overlap(n); o > best {
+			best, bi = o, i
+		}
+	}
+
+	return words[bi]
+}
+
+// axisAngle returns the rotation axis and angle of m in SU(2),
+// where m = cos(theta/2) I - i sin(theta/2) (n . sigma).
+func axisAngle(m su2) ([3]float64, float64) {
+	x := real(1i*(m[1]+m[2])) / 2
+	y := real(m[2]-m[1]) / 2
+	z := real(1i*(m[0]-m[3])) / 2
+
+	s := math.Sqrt(x*x + y*y + z*z)
+	theta := 2 * math.Atan2(s, real(m[0]+m[3])/2)
+	if s < 1e-15 {
+		return [3]float64{0, 0, 1}, theta
+	}
+
+	return [3]float64{x / s, y / s, z / s}, theta
+}
+
+// rotation returns the rotation by theta around axis n.
+func rotation(n [3]float64, theta float64) su2 {
+	c, s := complex(math.Cos(theta/2), 0), complex(math.Sin(theta/2), 0)
+	x, y, z := complex(n[0], 0), complex(n[1], 0), complex(n[2], 0)
+
+	return su2{
+		c - 1i*s*z, -1i*s*x - s*y,
+		-1i*s*x + s*y, c + 1i*s*z,
+	}
+}
+
+// groupCommutator returns v and w with m = v w v^dagger w^dagger,
+// using the balanced group commutator of Dawson and Nielsen.
+func groupCommutator(m su2) (su2, su2) {
+	n, theta := axisAngle(m)
+
+	// sin(theta/2) = 2 sin^2(phi/2) sqrt(1 - sin^4(phi/2)).
+	phi := 2 * math.Asin(math.Sqrt(math.Sqrt((1-math.Cos(theta/2))/2)))
+	v := rotation([3]float64{1, 0, 0}, phi)
+	w := rotation([3]float64{0, 1, 0}, phi)
+
+	// Rotate the axis of the commutator to n.
+	a, _ := axisAngle(v.mul(w).mul(v.dagger()).mul(w.dagger()))
+	cross := [3]float64{a[1]*n[2] - a[2]*n[1], a[2]*n[0] - a[0]*n[2], a[0]*n[1] - a[1]*n[0]}
+	dot := a[0]*n[0] + a[1]*n[1] + a[2]*n[2]
+
+	r := su2{1, 0, 0, 1}
+	if l := math.Sqrt(cross[0]*cross[0] + cross[1]*cross[1] + cross[2]*cross[2]); l > 1e-15 {
+		r = rotation([3]float64{cross[0] / l, cross[1] / l, cross[2] / l}, math.Atan2(l, dot))
+	} else if dot < 0 {
+		r = rotation([3]float64{0, 0, 1}, math.Pi)
+	}
+
+	return r.mul(v).mul(r.dagger()), r.mul(w).mul(r.dagger())
+}
+
+// solovayKitaev returns a sequence approximating m with recursion depth n.
+func solovayKitaev(m su2, n int) CliffordT {
+	if n == 0 {
+		return nearest(m)
+	}
+
+	u := solovayKitaev(m, n-1)
+	v, w := groupCommutator(m.mul(u.matrix().dagger()).special())
+	sv, sw := solovayKitaev(v, n-1), solovayKitaev(w, n-1)
+
+	// m = v w v^dagger w^dagger u, so u is applied first.
+	r := CliffordT{}
+	for _, s := range []CliffordT{u, sw.Dagger(), sv.Dagger(), sw, sv} {
+		r = append(r, s...)
+	}
+
+	return r.simplify()
+}
+
+// SolovayKitaev approximates one qubit gate g by Clifford+T gates using Solovay-Kitaev algorithm
+// with recursion depth n, ignoring the global phase.
+func SolovayKitaev(g qsim.Gate, n int) CliffordT {
+	return solovayKitaev(toSU2(g), n)
+}
+
+// maxDepth is the maximum recursion depth of ApproximateCliffordT.
+const maxDepth = 8
+
+// ApproximateCliffordT approximates one qubit gate g by Clifford+T gates, ignoring the global phase,
+// so that the Distance between g and the result is at most epsilon.
+// The recursion depth of Solovay-Kitaev algorithm is increased until the precision is reached.
+func ApproximateCliffordT(g qsim.Gate, epsilon float64) CliffordT {
+	m := toSU2(g)
+	for n := 0; n <= maxDepth; n++ {
+		if s := solovayKitaev(m, n); distance(m, s.matrix()) <= epsilon {
+			return s
+		}
+	}
+
+	panic("Cannot reach the precision.")
+}
+
+// ExactZ returns the exact Clifford+T sequence of P(phi), ignoring the global phase,
+// if phi is a multiple of pi/4. Otherwise, it returns false.
+func ExactZ(phi float64) (CliffordT, bool) {
+	k := math.Round(phi / (math.Pi / 4))
+	if math.Abs(phi-k*math.Pi/4) > eps {
+		return nil, false
+	}
+
+	return append(CliffordT{}, diagonalGates[((int(k)%8)+8)%8]...), true
+}
+
+// ZRotation returns a Clifford+T sequence of P(phi) within epsilon, ignoring the global phase.
+// This is exact with at most one T gate if phi is a multiple of pi/4.
+func ZRotation(phi, epsilon float64) CliffordT {
+	if s, ok := ExactZ(phi); ok {
+		return s
+	}
+
+	return ApproximateCliffordT(qsim.P(phi), epsilon)
+}
+
+// CliffordTCircuit returns a circuit equivalent to c up to the global phase, using only CX and Clifford+T gates.
+// Each one qubit gate is approximated within epsilon, singly controlled gates are decomposed
+// by ControlledU first, and SWAP gates become three CX gates. Other gates, measurements, resets and conditions are not supported.
+// The result only records instructions, so c may be too large to simulate.
+// The T-count of the result is reported by Circuit.Metrics.
+func CliffordTCircuit(c *qsim.Circuit, epsilon float64) *qsim.Circuit {
+	r := qsim.NewRecorder(c.Size())
+
+	one := func(g qsim.Gate, i int) {
+		// Diagonal gates are P(phi) up to the global phase, which are exact if phi is a multiple of pi/4.
+		if cmplx.Abs(g.At(0, 1)) < 1e-12 && cmplx.Abs(g.At(1, 0)) < 1e-12 {
+			ZRotation(cmplx.Phase(g.At(1, 1))-cmplx.Phase(g.At(0, 0)), epsilon).apply(r, i)
+			return
+		}
+		ApproximateCliffordT(g, epsilon).apply(r, i)
+	}
+
+	for _, inst := range c.Instructions() {
+		if inst.Cond != nil {
+			panic("Conditions are not supported.")
+		}
+
+		switch inst.Kind {
+		case qsim.KindBarrier:
+			r.Barrier(inst.Targets...)
+			continue
+		case qsim.KindGate:
+		default:
+			panic("Only gates are supported.")
+		}
+
+		switch {
+		case inst.Gate.Size() == 2 && inst.Gate.Equals(qsim.SWAP()) && len(inst.Controls) == 0:
+			t0, t1 := inst.Targets[0], inst.Targets[1]
+			r.CX(t0, t1)
+			r.CX(t1, t0)
+			r.CX(t0, t1)
+		case len(inst.Targets) != 1 || len(inst.Controls) > 1:
+			panic("Only one qubit gates with at most one control are supported.")
+		case len(inst.Controls) == 0:
+			one(inst.Gate, inst.Targets[0])
+		case inst.Gate.Equals(qsim.X()):
+			r.CX(inst.Controls[0], inst.Targets[0])
+		default:
+			qubits := []int{inst.Controls[0], inst.Targets[0]}
+			for _, d := range ControlledU(inst.Gate).Instructions() {
+				if len(d.Controls) == 0 {
+					one(d.Gate, qubits[d.Targets[0]])
+				} else {
+					r.CX(qubits[d.Controls[0]], qubits[d.Targets[0]])
+				}
+			}
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,65 @@
+package synth
+
+import (
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
+)
+
+// targetOf returns U from a controlled-U gate, where qubit 0 is the control and qubit 1 is the target.
+// If g is a one qubit gate, g itself is returned.
+func targetOf(g qsim.Gate) qsim.Gate {
+	switch g.Size() {
+	case 1:
+		return g
+	case 2:
+	default:
+		panic("Gate should be a one or two qubit gate.")
+	}
+
+	// Rows and columns with control 0 should be the identity.
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			if i&1 == 1 && j&1 == 1 {
+				continue
+			}
+
+			want := complex(0, 0)
+			if i == j {
+				want = 1
+			}
+			if d := g.At(i, j) - want; real(d)*real(d)+imag(d)*imag(d) > eps {
+				panic("Gate is not a controlled gate.")
+			}
+		}
+	}
+
+	return qsim.NewGate(mat.NewMatVars(2, g.At(1, 1), g.At(1, 3), g.At(3, 1), g.At(3, 3)))
+}
+
+// ControlledU decomposes a controlled-U gate into two CX gates and one qubit rotations,
+// using U = exp(i Phase) A X B X C where ABC = I.
+// g is either U, or a two qubit gate where qubit 0 is the control and qubit 1 is the target,
+// which is the gate applied by Control(U, []int{0}, []int{1}).
+// The returned circuit has two qubits, where qubit 0 is the control.
+func ControlledU(g qsim.Gate) *qsim.Circuit {
+	e := ZYZ(targetOf(g))
+	c := qsim.NewCircuit(2)
+
+	// C = RZ((Gamma-Alpha)/2).
+	c.RZ((e.Gamma-e.Alpha)/2, 1)
+	c.CX(0, 1)
+
+	// B = RY(-Beta/2) RZ(-(Gamma+Alpha)/2).
+	c.RZ(-(e.Gamma+e.Alpha)/2, 1)
+	c.RY(-e.Beta/2, 1)
+	c.CX(0, 1)
+
+	// A = RZ(Alpha) RY(Beta/2).
+	c.RY(e.Beta/2, 1)
+	c.RZ(e.Alpha, 1)
+
+	// Global phase of U becomes a relative phase on the control.
+	c.P(e.Phase, 0)
+
+	return c
+}
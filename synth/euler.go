@@ -0,0 +1,123 @@
+// Package synth decomposes arbitrary gates into circuits of elementary gates.
+// Decompositions are returned as qsim circuits, which can be inspected by Circuit.Unitary
+// or applied to other circuits by Circuit.Append.
+package synth
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/sp301415/qsim"
+)
+
+// Tolerance for treating numbers as zero.
+const eps = 1e-9
+
+// Euler is an Euler angle decomposition of a one qubit gate,
+// U = exp(i Phase) R1(Alpha) R2(Beta) R1(Gamma), where (R1, R2) is (RZ, RY) or (RZ, RX).
+type Euler struct {
+	Basis string // "ZYZ" or "ZXZ".
+	Phase float64
+	Alpha float64
+	Beta  float64
+	Gamma float64
+}
+
+// checkOne panics if g is not a one qubit gate.
+func checkOne(g qsim.Gate) {
+	if g.Size() != 1 {
+		panic("Gate should be a one qubit gate.")
+	}
+}
+
+// ZYZ decomposes one qubit gate g into exp(i Phase) RZ(Alpha) RY(Beta) RZ(Gamma).
+func ZYZ(g qsim.Gate) Euler {
+	checkOne(g)
+
+	// Remove global phase, so that V is in SU(2).
+	det := g.At(0, 0)*g.At(1, 1) - g.At(0, 1)*g.At(1, 0)
+	phase := cmplx.Phase(det) / 2
+	p := cmplx.Rect(1, -phase)
+	v00, v10, v11 := g.At(0, 0)*p, g.At(1, 0)*p, g.At(1, 1)*p
+
+	// V = [[e^{-i(a+c)/2} cos(b/2), ...], [e^{i(a-c)/2} sin(b/2), e^{i(a+c)/2} cos(b/2)]].
+	beta := 2 * math.Atan2(cmplx.Abs(v10), cmplx.Abs(v00))
+
+	sum, diff := 0.0, 0.0
+	if cmplx.Abs(v11) > eps {
+		sum = 2 * cmplx.Phase(v11)
+	}
+	if cmplx.Abs(v10) > eps {
+		diff = 2 * cmplx.Phase(v10)
+	}
+
+	return Euler{
+		Basis: "ZYZ",
+		Phase: phase,
+		Alpha: (sum + diff) / 2,
+		Beta:  beta,
+		Gamma: (sum - diff) / 2,
+	}
+}
+
+// ZXZ decomposes one qubit gate g into exp(i Phase) RZ(Alpha) RX(Beta) RZ(Gamma).
+func ZXZ(g qsim.Gate) Euler {
+	e := ZYZ(g)
+
+	// RY(b) = RZ(pi/2) RX(b) RZ(-pi/2).
+	e.Basis = "ZXZ"
+	e.Alpha += math.Pi / 2
+	e.Gamma -= math.Pi / 2
+
+	return e
+}
+
+// Circuit returns the one qubit circuit of e, ignoring the global phase.
+func (e Euler) Circuit() *qsim.Circuit {
+	c := qsim.NewCircuit(1)
+
+	c.RZ(e.Gamma, 0)
+	switch e.Basis {
+	case "ZYZ":
+		c.RY(e.Beta, 0)
+	case "ZXZ":
+		c.RX(e.Beta, 0)
+	default:
+		panic("Invalid Euler basis.")
+	}
+	c.RZ(e.Alpha, 0)
+
+	return c
+}
+
+// Gate returns the gate of e, including the global phase.
+func (e Euler) Gate() qsim.Gate {
+	m := e.Circuit().Unitary(false).ScalarMul(cmplx.Rect(1, e.Phase))
+	return qsim.NewGate(m)
+}
+
+// U3Params are parameters of U3 gate, where U = exp(i Phase) U3(Theta, Phi, Lambda).
+type U3Params struct {
+	Theta  float64
+	Phi    float64
+	Lambda float64
+	Phase  float64
+}
+
+// U3 decomposes one qubit gate g into exp(i Phase) U3(Theta, Phi, Lambda).
+func U3(g qsim.Gate) U3Params {
+	e := ZYZ(g)
+
+	// U3(t, p, l) = exp(i(p+l)/2) RZ(p) RY(t) RZ(l).
+	return U3Params{
+		Theta:  e.Beta,
+		Phi:    e.Alpha,
+		Lambda: e.Gamma,
+		Phase:  e.Phase - (e.Alpha+e.Gamma)/2,
+	}
+}
+
+// Gate returns the U3 gate of p, ignoring the global phase.
+func (p U3Params) Gate() qsim.Gate {
+	return qsim.U3(p.Theta, p.Phi, p.Lambda)
+}
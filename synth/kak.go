@@ -0,0 +1,427 @@
+package synth
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
+)
+
+// KAK is the Cartan decomposition of a two qubit gate,
+// U = exp(i Phase) (A1 * B1) exp(i(C[0] XX + C[1] YY + C[2] ZZ)) (A2 * B2),
+// where * is the tensor product. Following Gate.Tensor, A1 and A2 act on qubit 1, and B1 and B2 act on qubit 0.
+// C are the Weyl coordinates in the Weyl chamber, pi/4 >= C[0] >= C[1] >= |C[2]|.
+type KAK struct {
+	Phase  float64
+	A1, B1 qsim.Gate
+	C      [3]float64
+	A2, B2 qsim.Gate
+}
+
+// magic is the magic basis, where local gates become real orthogonal matrices.
+// Each column is an eigenvector of XX, YY and ZZ.
+var magic = mat.NewMatVars(4,
+	1, 0, 0, 1i,
+	0, 1i, 1, 0,
+	0, 1i, -1, 0,
+	1, 0, 0, -1i,
+).ScalarMul(complex(1/math.Sqrt2, 0))
+
+// Paulis and rotations used to move coordinates into the Weyl chamber.
+var (
+	paulis = [3]mat.Mat{qsim.X().ToMat(), qsim.Y().ToMat(), qsim.Z().ToMat()}
+
+	// swappers[i+j-1] maps sigma_i to sigma_j, and sigma_j to -sigma_i.
+	swappers = [3]mat.Mat{qsim.S().ToMat(), qsim.RY(-math.Pi / 2).ToMat(), qsim.RX(math.Pi / 2).ToMat()}
+)
+
+// unitarize returns the unitary nearest to m, which is m (m^dagger m)^(-1/2) by the polar decomposition.
+// Gates may be unitary only within the tolerance of NewGate, which is too loose for exact eigenvectors.
+func unitarize(m mat.Mat) mat.Mat {
+	w, v := m.Dagger().Mul(m).EigenHermitian()
+	d := mat.NewSquare(len(w))
+	for i := range w {
+		d[i][i] = complex(1/math.Sqrt(w[i]), 0)
+	}
+
+	return m.Mul(v).Mul(d).Mul(v.Dagger())
+}
+
+// maxRetries is the number of random combinations tried when diagonalizing commuting matrices simultaneously.
+const maxRetries = 100
+
+// newRand returns the random source of decompositions, seeded so that results are reproducible.
+func newRand() *rand.Rand {
+	return rand.New(rand.NewSource(1))
+}
+
+// det returns the determinant of square matrix m, using Gaussian elimination.
+func det(m mat.Mat) complex128 {
+	a := m.Copy()
+	n := a.NRows()
+	r := complex(1, 0)
+
+	for i := 0; i < n; i++ {
+		p := i
+		for k := i + 1; k < n; k++ {
+			if cmplx.Abs(a[k][i]) > cmplx.Abs(a[p][i]) {
+				p = k
+			}
+		}
+		if a[p][i] == 0 {
+			return 0
+		}
+		if p != i {
+			a[p], a[i] = a[i], a[p]
+			r = -r
+		}
+
+		r *= a[i][i]
+		for k := i + 1; k < n; k++ {
+			f := a[k][i] / a[i][i]
+			for j := i; j < n; j++ {
+				a[k][j] -= f * a[i][j]
+			}
+		}
+	}
+
+	return r
+}
+
+// transpose returns the transpose of m.
+func transpose(m mat.Mat) mat.Mat {
+	r := mat.NewMat(m.NCols(), m.NRows())
+	for i := range m {
+		for j := range m[i] {
+			r[j][i] = m[i][j]
+		}
+	}
+
+	return r
+}
+
+// factorTensor factors a 4x4 matrix k = a * b, where a and b are in SU(2) up to a sign.
+func factorTensor(k mat.Mat) (mat.Mat, mat.Mat) {
+	block := func(i, j int) mat.Mat {
+		return mat.NewMatVars(2, k[2*i][2*j], k[2*i][2*j+1], k[2*i+1][2*j], k[2*i+1][2*j+1])
+	}
+
+	// k[2i+r][2j+s] = a[i][j] b[r][s], so use the largest block for b.
+	bi, bj, best := 0, 0, -1.0
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			if n := cmplx.Abs(det(block(i, j))); n > best {
+				bi, bj, best = i, j, n
+			}
+		}
+	}
+
+	b := block(bi, bj)
+	b = b.ScalarMul(1 / cmplx.Sqrt(det(b)))
+
+	a := mat.NewSquare(2)
+	bd := b.Dagger()
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			t := bd.Mul(block(i, j))
+			a[i][j] = (t[0][0] + t[1][1]) / 2
+		}
+	}
+
+	return a, b
+}
+
+// kak holds the Cartan decomposition while moving coordinates into the Weyl chamber.
+type kak struct {
+	phase          float64
+	a1, b1, a2, b2 mat.Mat
+	c              [3]float64
+}
+
+// shift subtracts s*pi/2 from c[k], using exp(i s pi/2 sigma_k sigma_k) = i s sigma_k * sigma_k.
+func (k *kak) shift(i int, s float64) {
+	k.c[i] -= s * math.Pi / 2
+	k.a2 = paulis[i].Mul(k.a2)
+	k.b2 = paulis[i].Mul(k.b2)
+	k.phase += s * math.Pi / 2
+}
+
+// negate negates c[i] and c[j], by conjugating with sigma_m * I where m is the other axis.
+func (k *kak) negate(i, j int) {
+	m := 3 - i - j
+	k.c[i], k.c[j] = -k.c[i], -k.c[j]
+	k.a1 = k.a1.Mul(paulis[m])
+	k.a2 = paulis[m].Mul(k.a2)
+}
+
+// swap swaps c[i] and c[j], by conjugating with R * R where R maps sigma_i to sigma_j.
+func (k *kak) swap(i, j int) {
+	r := swappers[i+j-1]
+	rd := r.Dagger()
+	k.c[i], k.c[j] = k.c[j], k.c[i]
+	k.a1, k.b1 = k.a1.Mul(rd), k.b1.Mul(rd)
+	k.a2, k.b2 = r.Mul(k.a2), r.Mul(k.b2)
+}
+
+// canonicalize moves coordinates into the Weyl chamber.
+func (k *kak) canonicalize() {
+	// Move each coordinate into (-pi/4, pi/4].
+	for i := range k.c {
+		for k.c[i] > math.Pi/4+eps {
+			k.shift(i, 1)
+		}
+		for k.c[i] <= -math.Pi/4+eps {
+			k.shift(i, -1)
+		}
+	}
+
+	// Sort by absolute values.
+	for n := 0; n < 2; n++ {
+		for i := 0; i < 2; i++ {
+			if math.Abs(k.c[i]) < math.Abs(k.c[i+1]) {
+				k.swap(i, i+1)
+			}
+		}
+	}
+
+	if k.c[0] < 0 {
+		k.negate(0, 2)
+	}
+	if k.c[1] < 0 {
+		k.negate(1, 2)
+	}
+
+	// pi/4 and -pi/4 are equivalent, so c[2] can be made nonnegative.
+	if k.c[0] > math.Pi/4-eps && k.c[2] < 0 {
+		k.shift(0, 1)
+		k.negate(0, 2)
+	}
+}
+
+// KAKDecompose returns the Cartan decomposition of two qubit gate g.
+func KAKDecompose(g qsim.Gate) KAK {
+	if g.Size() != 2 {
+		panic("Gate should be a two qubit gate.")
+	}
+
+	// Normalize into SU(4), and move into the magic basis.
+	u := unitarize(g.ToMat())
+	d := det(u)
+	phase := cmplx.Phase(d) / 4
+	u = u.ScalarMul(cmplx.Rect(1, -phase))
+	up := magic.Dagger().Mul(u).Mul(magic)
+
+	// Up^T Up = P D P^T, where P is real orthogonal.
+	// Real and imaginary parts of Up^T Up are commuting real symmetric matrices,
+	// so a random linear combination of them has the same eigenvectors.
+	m := transpose(up).Mul(up)
+	var p mat.Mat
+	rng := newRand()
+	for try := 0; ; try++ {
+		if try == maxRetries {
+			panic("KAK decomposition did not converge.")
+		}
+
+		x, y := rng.Float64(), rng.Float64()
+		r := mat.NewSquare(4)
+		for i := range r {
+			for j := range r[i] {
+				r[i][j] = complex(x*real(m[i][j])+y*imag(m[i][j]), 0)
+			}
+		}
+
+		_, p = r.EigenHermitian()
+		for i := range p {
+			for j := range p[i] {
+				p[i][j] = complex(real(p[i][j]), 0)
+			}
+		}
+
+		dm := transpose(p).Mul(m).Mul(p)
+		off := 0.0
+		for i := range dm {
+			for j := range dm[i] {
+				if i != j {
+					off += cmplx.Abs(dm[i][j])
+				}
+			}
+		}
+		if off < 1e-9 {
+			break
+		}
+	}
+
+	if real(det(p)) < 0 {
+		for i := range p {
+			p[i][0] = -p[i][0]
+		}
+	}
+
+	// Up = K1 A K2, where K2 = P^T and A = sqrt(D).
+	dm := transpose(p).Mul(m).Mul(p)
+	theta := make([]float64, 4)
+	for i := range theta {
+		theta[i] = cmplx.Phase(dm[i][i]) / 2
+	}
+
+	ainv := func() mat.Mat {
+		r := mat.NewSquare(4)
+		for i := range theta {
+			r[i][i] = cmplx.Rect(1, -theta[i])
+		}
+		return r
+	}
+
+	k1 := up.Mul(p).Mul(ainv())
+	if real(det(k1)) < 0 {
+		theta[0] += math.Pi
+		k1 = up.Mul(p).Mul(ainv())
+	}
+	k2 := transpose(p)
+
+	// A = exp(i g) exp(i(c0 XX + c1 YY + c2 ZZ)) in the computational basis,
+	// where magic columns have eigenvalues (XX, YY, ZZ) of (1, -1, 1), (1, 1, -1), (-1, -1, -1), (-1, 1, 1).
+	gp := (theta[0] + theta[1] + theta[2] + theta[3]) / 4
+	for i := range theta {
+		theta[i] -= gp
+	}
+
+	r := &kak{phase: phase + gp}
+	r.c = [3]float64{(theta[0] + theta[1]) / 2, (theta[1] + theta[3]) / 2, (theta[0] + theta[3]) / 2}
+	r.a1, r.b1 = factorTensor(magic.Mul(k1).Mul(magic.Dagger()))
+	r.a2, r.b2 = factorTensor(magic.Mul(k2).Mul(magic.Dagger()))
+	r.canonicalize()
+
+	return KAK{
+		Phase: r.phase,
+		A1:    qsim.NewGate(r.a1),
+		B1:    qsim.NewGate(r.b1),
+		C:     r.c,
+		A2:    qsim.NewGate(r.a2),
+		B2:    qsim.NewGate(r.b2),
+	}
+}
+
+// WeylCoordinates returns the Weyl coordinates of two qubit gate g.
+// Two gates are equal up to one qubit gates if and only if their Weyl coordinates are equal.
+func WeylCoordinates(g qsim.Gate) [3]float64 {
+	return KAKDecompose(g).C
+}
+
+// Interaction returns exp(i(c[0] XX + c[1] YY + c[2] ZZ)).
+func Interaction(c [3]float64) qsim.Gate {
+	m := mat.NewSquare(4)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += complex(c[k], 0) * paulis[k].Tensor(paulis[k])[i][j]
+			}
+		}
+	}
+
+	// exp(iH) = M exp(i diag) M^dagger, since H is diagonal in the magic basis.
+	d := magic.Dagger().Mul(m).Mul(magic)
+	e := mat.NewSquare(4)
+	for i := range e {
+		e[i][i] = cmplx.Exp(1i * d[i][i])
+	}
+
+	return qsim.NewGate(magic.Mul(e).Mul(magic.Dagger()))
+}
+
+// Gate returns the gate of k, including the global phase.
+func (k KAK) Gate() qsim.Gate {
+	m := k.A1.Tensor(k.B1).ToMat().
+		Mul(Interaction(k.C).ToMat()).
+		Mul(k.A2.Tensor(k.B2).ToMat()).
+		ScalarMul(cmplx.Rect(1, k.Phase))
+
+	return qsim.NewGate(m)
+}
+
+// CXCount returns the minimal number of CX gates to implement the gate of k,
+// which is determined by the Weyl coordinates.
+func (k KAK) CXCount() int {
+	tol := 1e-7
+	near := func(x, y float64) bool { return math.Abs(x-y) < tol }
+
+	switch {
+	case near(k.C[0], 0) && near(k.C[1], 0) && near(k.C[2], 0):
+		return 0
+	case near(k.C[0], math.Pi/4) && near(k.C[1], 0) && near(k.C[2], 0):
+		return 1
+	case near(k.C[2], 0):
+		return 2
+	}
+
+	return 3
+}
+
+// interactionCircuit returns a circuit with n CX gates,
+// which has the same Weyl coordinates c up to one qubit gates.
+func interactionCircuit(c [3]float64, n int) *qsim.Circuit {
+	r := qsim.NewCircuit(2)
+
+	switch n {
+	case 1:
+		r.CX(0, 1)
+	case 2:
+		// CX (RX(t) * RZ(s)) CX = exp(-i t/2 XX) exp(-i s/2 ZZ).
+		r.CX(0, 1)
+		r.RX(-2*c[0], 0)
+		r.RZ(-2*c[1], 1)
+		r.CX(0, 1)
+	case 3:
+		// Vatan and Williams, Optimal quantum circuits for general two-qubit gates.
+		r.RZ(math.Pi/2, 1)
+		r.CX(1, 0)
+		r.RZ(math.Pi/2-2*c[0], 0)
+		r.RY(math.Pi/2-2*c[1], 1)
+		r.CX(0, 1)
+		r.RY(math.Pi/2+2*c[2], 1)
+		r.CX(1, 0)
+		r.RZ(-math.Pi/2, 0)
+	}
+
+	return r
+}
+
+// applyLocal applies one qubit gate m to qubit i as U3, unless it is the identity up to global phase.
+func applyLocal(c *qsim.Circuit, m mat.Mat, i int) {
+	if cmplx.Abs(m[0][1]) < eps && cmplx.Abs(m[1][0]) < eps && cmplx.Abs(m[0][0]-m[1][1]) < eps {
+		return
+	}
+
+	p := U3(qsim.NewGate(m))
+	c.U3(p.Theta, p.Phi, p.Lambda, i)
+}
+
+// Circuit returns the two qubit circuit of k with minimal number of CX gates and U3 gates,
+// ignoring the global phase.
+func (k KAK) Circuit() *qsim.Circuit {
+	v := interactionCircuit(k.C, k.CXCount())
+	kv := KAKDecompose(v.ToGate())
+
+	// Both are A(c) up to local gates, so U = (L1 * L1') V (L2' * L2).
+	a1 := k.A1.ToMat().Mul(kv.A1.ToMat().Dagger())
+	b1 := k.B1.ToMat().Mul(kv.B1.ToMat().Dagger())
+	a2 := kv.A2.ToMat().Dagger().Mul(k.A2.ToMat())
+	b2 := kv.B2.ToMat().Dagger().Mul(k.B2.ToMat())
+
+	r := qsim.NewCircuit(2)
+	applyLocal(r, b2, 0)
+	applyLocal(r, a2, 1)
+	r.Append(v, nil)
+	applyLocal(r, b1, 0)
+	applyLocal(r, a1, 1)
+
+	return r
+}
+
+// DecomposeTwo decomposes two qubit gate g into a circuit with at most three CX gates and U3 gates,
+// ignoring the global phase.
+func DecomposeTwo(g qsim.Gate) *qsim.Circuit {
+	return KAKDecompose(g).Circuit()
+}
@@ -0,0 +1,131 @@
+package synth
+
+import (
+	"math/cmplx"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// sqrtGate returns V with V^2 = g, for one qubit gate g.
+// This uses sqrt(U) = (U + sI) / sqrt(tr U + 2s), where s^2 = det U.
+func sqrtGate(g qsim.Gate) qsim.Gate {
+	checkOne(g)
+
+	m := g.ToMat()
+	s := cmplx.Sqrt(m[0][0]*m[1][1] - m[0][1]*m[1][0])
+	tr := m[0][0] + m[1][1]
+	if cmplx.Abs(tr-2*s) > cmplx.Abs(tr+2*s) {
+		s = -s
+	}
+
+	t := cmplx.Sqrt(tr + 2*s)
+	return qsim.NewGate(m.Add(mat.NewId(2).ScalarMul(s)).ScalarMul(1 / t))
+}
+
+// checkMC panics if registers of multi-controlled gates are invalid.
+func checkMC(ctrls []int, target int, ancillas []int) {
+	regs := append(append([]int{target}, ctrls...), ancillas...)
+	if slice.HasDuplicate(regs) {
+		panic("Duplicate registers.")
+	}
+}
+
+// Toffoli applies Toffoli gate to c using six CX gates and seven T gates.
+func Toffoli(c *qsim.Circuit, c0, c1, target int) {
+	checkMC([]int{c0, c1}, target, nil)
+
+	tdg := qsim.T().Dagger()
+
+	c.H(target)
+	c.CX(c1, target)
+	c.Apply(tdg, target)
+	c.CX(c0, target)
+	c.T(target)
+	c.CX(c1, target)
+	c.Apply(tdg, target)
+	c.CX(c0, target)
+	c.T(c1, target)
+	c.H(target)
+	c.CX(c0, c1)
+	c.T(c0)
+	c.Apply(tdg, c1)
+	c.CX(c0, c1)
+}
+
+// vchain computes AND of ctrls into the last ancilla, using ancillas as clean work qubits.
+// If undo is true, it uncomputes instead.
+func vchain(c *qsim.Circuit, ctrls, ancillas []int, undo bool) {
+	k := len(ctrls)
+	steps := make([][3]int, 0, k-1)
+	steps = append(steps, [3]int{ctrls[0], ctrls[1], ancillas[0]})
+	for i := 2; i < k; i++ {
+		steps = append(steps, [3]int{ctrls[i], ancillas[i-2], ancillas[i-1]})
+	}
+
+	if undo {
+		for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+			steps[i], steps[j] = steps[j], steps[i]
+		}
+	}
+
+	for _, s := range steps {
+		Toffoli(c, s[0], s[1], s[2])
+	}
+}
+
+// MCX applies multi-controlled X gate to c, using only CX and one qubit gates.
+// If at least len(ctrls)-2 ancillas are given, this uses the V-chain of Toffoli gates,
+// with ancillas assumed to be in |0> and restored to |0>.
+// Otherwise, this uses the recursion of Barenco et al. without ancillas, with exponential number of gates.
+func MCX(c *qsim.Circuit, ctrls []int, target int, ancillas ...int) {
+	checkMC(ctrls, target, ancillas)
+
+	k := len(ctrls)
+	switch {
+	case k == 0:
+		c.X(target)
+	case k == 1:
+		c.CX(ctrls[0], target)
+	case k == 2:
+		Toffoli(c, ctrls[0], ctrls[1], target)
+	case len(ancillas) >= k-2:
+		vchain(c, ctrls[:k-1], ancillas[:k-2], false)
+		Toffoli(c, ctrls[k-1], ancillas[k-3], target)
+		vchain(c, ctrls[:k-1], ancillas[:k-2], true)
+	default:
+		MCU(c, qsim.X(), ctrls, target)
+	}
+}
+
+// MCU applies multi-controlled U gate to c, using only CX and one qubit gates.
+// If at least len(ctrls)-1 ancillas are given, AND of ctrls is computed into an ancilla
+// by the V-chain of Toffoli gates, with ancillas assumed to be in |0> and restored to |0>.
+// Otherwise, this uses the recursion of Barenco et al. without ancillas.
+func MCU(c *qsim.Circuit, u qsim.Gate, ctrls []int, target int, ancillas ...int) {
+	checkOne(u)
+	checkMC(ctrls, target, ancillas)
+
+	k := len(ctrls)
+	switch {
+	case k == 0:
+		c.Apply(u, target)
+	case k == 1:
+		c.Append(ControlledU(u), []int{ctrls[0], target})
+	case len(ancillas) >= k-1:
+		vchain(c, ctrls, ancillas[:k-1], false)
+		c.Append(ControlledU(u), []int{ancillas[k-2], target})
+		vchain(c, ctrls, ancillas[:k-1], true)
+	default:
+		// C^k U = C^(k-1) V . C^(k-1) X . C V^dagger . C^(k-1) X . C V, where V^2 = U.
+		v := sqrtGate(u)
+		last, rest := ctrls[k-1], ctrls[:k-1]
+
+		c.Append(ControlledU(v), []int{last, target})
+		MCX(c, rest, last)
+		c.Append(ControlledU(v.Dagger()), []int{last, target})
+		MCX(c, rest, last)
+		MCU(c, v, rest, target)
+	}
+}
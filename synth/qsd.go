@@ -0,0 +1,257 @@
+package synth
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
+	"github.com/sp301415/qsim/math/vec"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// block returns the (i, j)th block of m, when m is split into 2x2 blocks.
+func block(m mat.Mat, i, j int) mat.Mat {
+	h := m.NRows() / 2
+	r := mat.NewSquare(h)
+	for k := 0; k < h; k++ {
+		copy(r[k], m[i*h+k][j*h:(j+1)*h])
+	}
+
+	return r
+}
+
+// eigenUnitary returns eigenvalues and eigenvectors of unitary u, as u = V diag(vals) V^dagger.
+// Hermitian and anti-Hermitian parts of u commute, so a random linear combination of them
+// is a Hermitian matrix with the same eigenvectors.
+func eigenUnitary(u mat.Mat) ([]complex128, mat.Mat) {
+	n := u.NRows()
+	ud := u.Dagger()
+
+	rng := newRand()
+	for try := 0; try < maxRetries; try++ {
+		x, y := rng.Float64(), rng.Float64()
+		h := mat.NewSquare(n)
+		for i := range h {
+			for j := range h[i] {
+				re := (u[i][j] + ud[i][j]) / 2
+				im := (u[i][j] - ud[i][j]) / 2i
+				h[i][j] = complex(x, 0)*re + complex(y, 0)*im
+			}
+		}
+		// Remove rounding errors, so that h is exactly Hermitian.
+		for i := range h {
+			h[i][i] = complex(real(h[i][i]), 0)
+			for j := i + 1; j < n; j++ {
+				h[j][i] = cmplx.Conj(h[i][j])
+			}
+		}
+
+		_, v := h.EigenHermitian()
+		d := v.Dagger().Mul(u).Mul(v)
+
+		off := 0.0
+		vals := make([]complex128, n)
+		for i := range d {
+			vals[i] = d[i][i]
+			for j := range d[i] {
+				if i != j {
+					off += cmplx.Abs(d[i][j])
+				}
+			}
+		}
+
+		if off < 1e-9 {
+			return vals, v
+		}
+	}
+
+	panic("Eigendecomposition of unitary did not converge.")
+}
+
+// orthonormalize makes columns of m orthonormal by Gram-Schmidt process, in the given order.
+// Columns which are nearly zero are replaced by vectors orthogonal to the previous columns.
+func orthonormalize(m mat.Mat, order []int) {
+	n := m.NRows()
+	done := make([]vec.Vec, 0, n)
+
+	for _, k := range order {
+		v := m.GetCol(k)
+		for e := 0; ; e++ {
+			for _, u := range done {
+				v = v.Sub(u.ScalarMul(v.Dot(u)))
+			}
+			if v.Norm() > 1e-7 {
+				break
+			}
+
+			// Try basis vectors until one is independent.
+			v = vec.NewVec(n)
+			v[e] = 1
+		}
+
+		v = v.ScalarMul(complex(1/v.Norm(), 0))
+		m.SetCol(k, v)
+		done = append(done, v)
+	}
+}
+
+// csd computes the cosine-sine decomposition of unitary u,
+// u = diag(L0, L1) [[C, -S], [S, C]] diag(R0, R1), and returns L0, L1, R0, R1 and angles theta,
+// where C = diag(cos(theta/2)) and S = diag(sin(theta/2)).
+func csd(u mat.Mat) (mat.Mat, mat.Mat, mat.Mat, mat.Mat, []float64) {
+	u00, u01, u10, u11 := block(u, 0, 0), block(u, 0, 1), block(u, 1, 0), block(u, 1, 1)
+	h := u00.NRows()
+
+	// u00^dagger u00 = R0^dagger C^2 R0.
+	vals, r0d := u00.Dagger().Mul(u00).EigenHermitian()
+	c, s := make([]float64, h), make([]float64, h)
+	for k, v := range vals {
+		v = math.Max(0, math.Min(1, v))
+		c[k], s[k] = math.Sqrt(v), math.Sqrt(1-v)
+	}
+
+	// Columns of u00 R0^dagger are c_k l0_k, and columns of u10 R0^dagger are s_k l1_k.
+	l0, l1 := u00.Mul(r0d), u10.Mul(r0d)
+	for k := 0; k < h; k++ {
+		for i := 0; i < h; i++ {
+			if c[k] > 1e-7 {
+				l0[i][k] /= complex(c[k], 0)
+			} else {
+				l0[i][k] = 0
+			}
+			if s[k] > 1e-7 {
+				l1[i][k] /= complex(s[k], 0)
+			} else {
+				l1[i][k] = 0
+			}
+		}
+	}
+
+	// Orthonormalize starting from well conditioned columns.
+	// Eigenvalues are ascending, so c_k is ascending and s_k is descending.
+	asc, desc := slice.Range(0, h), slice.Range(0, h)
+	for i, j := 0, h-1; i < j; i, j = i+1, j-1 {
+		desc[i], desc[j] = desc[j], desc[i]
+	}
+	orthonormalize(l0, desc)
+	orthonormalize(l1, asc)
+
+	// u01 = -L0 S R1 and u11 = L1 C R1. Use the larger of s_k and c_k for each row of R1.
+	a, b := l0.Dagger().Mul(u01), l1.Dagger().Mul(u11)
+	r1 := mat.NewSquare(h)
+	for k := 0; k < h; k++ {
+		for j := 0; j < h; j++ {
+			if s[k] > c[k] {
+				r1[k][j] = -a[k][j] / complex(s[k], 0)
+			} else {
+				r1[k][j] = b[k][j] / complex(c[k], 0)
+			}
+		}
+	}
+
+	theta := make([]float64, h)
+	for k := range theta {
+		theta[k] = 2 * math.Atan2(s[k], c[k])
+	}
+
+	return l0, l1, r0d.Dagger(), r1, theta
+}
+
+// demultiplex decomposes diag(a, b) = diag(V, V) diag(D, D^dagger) diag(W, W),
+// and returns V, W and angles of D^2.
+func demultiplex(a, b mat.Mat) (mat.Mat, mat.Mat, []float64) {
+	// a b^dagger = V D^2 V^dagger.
+	vals, v := eigenUnitary(a.Mul(b.Dagger()))
+
+	d := mat.NewSquare(len(vals))
+	phis := make([]float64, len(vals))
+	for i, x := range vals {
+		phis[i] = cmplx.Phase(x)
+		d[i][i] = cmplx.Rect(1, phis[i]/2)
+	}
+
+	// W = D V^dagger b.
+	w := d.Mul(v.Dagger()).Mul(b)
+
+	return v, w, phis
+}
+
+// MultiplexedRotation applies rotation gate rot(theta[j]) to target, where j is the value of ctrls,
+// using len(theta) rotations and CX gates. rot should be qsim.RY or qsim.RZ.
+// This uses the Gray code construction of Mottonen et al.
+func MultiplexedRotation(c *qsim.Circuit, rot func(float64) qsim.Gate, theta []float64, ctrls []int, target int) {
+	n := len(theta)
+	if n != 1<<len(ctrls) {
+		panic("Number of angles should be 2^len(ctrls).")
+	}
+
+	if n == 1 {
+		c.Apply(rot(theta[0]), target)
+		return
+	}
+
+	gray := func(i int) int { return i ^ (i >> 1) }
+
+	for i := 0; i < n; i++ {
+		// alpha_i = sum_j (-1)^(j . gray(i)) theta_j / n.
+		alpha := 0.0
+		for j, t := range theta {
+			if bits.OnesCount(uint(j&gray(i)))%2 == 0 {
+				alpha += t
+			} else {
+				alpha -= t
+			}
+		}
+		c.Apply(rot(alpha/float64(n)), target)
+
+		b := bits.TrailingZeros(uint(gray(i) ^ gray((i+1)%n)))
+		c.CX(ctrls[b], target)
+	}
+}
+
+// qsd applies unitary u to qubits of c, using the quantum Shannon decomposition.
+func qsd(c *qsim.Circuit, u mat.Mat, qubits []int) {
+	n := len(qubits)
+	switch n {
+	case 1:
+		p := U3(qsim.NewGate(u))
+		c.U3(p.Theta, p.Phi, p.Lambda, qubits[0])
+		return
+	case 2:
+		c.Append(DecomposeTwo(qsim.NewGate(u)), qubits)
+		return
+	}
+
+	lower, top := qubits[:n-1], qubits[n-1]
+	l0, l1, r0, r1, theta := csd(u)
+
+	// diag(L0, L1) [[C, -S], [S, C]] diag(R0, R1), applied from the right.
+	multiplexed := func(a, b mat.Mat) {
+		v, w, phis := demultiplex(a, b)
+		qsd(c, w, lower)
+
+		// diag(D, D^dagger) is RZ(-phi) on the top qubit, where D = exp(i phi/2).
+		for i := range phis {
+			phis[i] = -phis[i]
+		}
+		MultiplexedRotation(c, qsim.RZ, phis, lower, top)
+		qsd(c, v, lower)
+	}
+
+	multiplexed(r0, r1)
+	MultiplexedRotation(c, qsim.RY, theta, lower, top)
+	multiplexed(l0, l1)
+}
+
+// Decompose decomposes gate g into a circuit of CX and one qubit gates, ignoring the global phase.
+// One qubit gates become U3 gates, two qubit gates use the KAK decomposition,
+// and larger gates use the quantum Shannon decomposition of Shende, Bullock and Markov.
+// Qubit i of the returned circuit corresponds to bit i of the matrix index, same as Circuit.Apply.
+func Decompose(g qsim.Gate) *qsim.Circuit {
+	c := qsim.NewCircuit(g.Size())
+	qsd(c, unitarize(g.ToMat()), slice.Range(0, g.Size()))
+
+	return c
+}
@@ -0,0 +1,383 @@
+package synth_test
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
+	"github.com/sp301415/qsim/synth"
+)
+
+// randomGate returns a random one qubit gate.
+func randomGate() qsim.Gate {
+	return qsim.NewGate(qsim.U3(rand.Float64()*math.Pi, rand.Float64()*2*math.Pi, rand.Float64()*2*math.Pi).
+		ToMat().ScalarMul(cmplx.Rect(1, rand.Float64()*2*math.Pi)))
+}
+
+func TestEuler(t *testing.T) {
+	gates := []qsim.Gate{qsim.I(), qsim.X(), qsim.Y(), qsim.Z(), qsim.H(), qsim.S(), qsim.T().Dagger()}
+	for i := 0; i < 20; i++ {
+		gates = append(gates, randomGate())
+	}
+
+	for _, g := range gates {
+		if !synth.ZYZ(g).Gate().Equals(g) {
+			t.Fatalf("ZYZ %v", g)
+		}
+
+		if !synth.ZXZ(g).Gate().Equals(g) {
+			t.Fatalf("ZXZ %v", g)
+		}
+
+		p := synth.U3(g)
+		if !qsim.NewGate(p.Gate().ToMat().ScalarMul(cmplx.Rect(1, p.Phase))).Equals(g) {
+			t.Fatalf("U3 %v", g)
+		}
+	}
+}
+
+func TestControlledU(t *testing.T) {
+	gates := []qsim.Gate{qsim.X(), qsim.H(), qsim.T(), randomGate(), randomGate()}
+
+	for _, g := range gates {
+		ref := qsim.NewCircuit(2)
+		ref.Control(g, []int{0}, []int{1})
+		want := ref.Unitary(false)
+
+		c := synth.ControlledU(g)
+		if !c.Unitary(false).Equals(want) || c.Metrics().CXCount != 2 {
+			t.Fatalf("%v", g)
+		}
+
+		if !synth.ControlledU(qsim.NewGate(want)).Unitary(false).Equals(want) {
+			t.Fatalf("%v", g)
+		}
+	}
+}
+
+// randomTwo returns a random two qubit gate.
+func randomTwo() qsim.Gate {
+	c := qsim.NewCircuit(2)
+	for i := 0; i < 4; i++ {
+		c.Apply(randomGate(), 0)
+		c.Apply(randomGate(), 1)
+		c.CX(i%2, 1-i%2)
+	}
+
+	return c.ToGate()
+}
+
+// equalsUpToPhase checks if a = exp(i phi) b for some phi.
+func equalsUpToPhase(a, b mat.Mat) bool {
+	bi, bj := 0, 0
+	for i := range b {
+		for j := range b[i] {
+			if cmplx.Abs(b[i][j]) > cmplx.Abs(b[bi][bj]) {
+				bi, bj = i, j
+			}
+		}
+	}
+
+	return a.Equals(b.ScalarMul(a[bi][bj] / b[bi][bj]))
+}
+
+func TestKAK(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		g := randomTwo()
+		k := synth.KAKDecompose(g)
+
+		if !k.Gate().Equals(g) {
+			t.Fatalf("%v", k.C)
+		}
+
+		if k.C[0] > math.Pi/4+1e-9 || k.C[0] < k.C[1] || k.C[1] < math.Abs(k.C[2]) {
+			t.Fatalf("%v", k.C)
+		}
+	}
+}
+
+func TestKAKNearlyUnitary(t *testing.T) {
+	// Within the tolerance of NewGate, but not exactly unitary.
+	m := qsim.SWAP().ToMat()
+	m[0][1] += 3e-7
+	g := qsim.NewGate(m)
+
+	if k := synth.KAKDecompose(g); !k.Gate().Equals(g) {
+		t.Fatalf("%v", k.C)
+	}
+}
+
+func TestDecomposeTwo(t *testing.T) {
+	cx := qsim.NewCircuit(2)
+	cx.CX(1, 0)
+	cx.H(0)
+
+	iswap := synth.Interaction([3]float64{math.Pi / 4, math.Pi / 4, 0})
+
+	cases := []struct {
+		g    qsim.Gate
+		cnot int
+	}{
+		{qsim.H().Tensor(qsim.T()), 0},
+		{cx.ToGate(), 1},
+		{iswap, 2},
+		{synth.Interaction([3]float64{0.3, -0.2, 0}), 2},
+		{qsim.SWAP(), 3},
+		{synth.Interaction([3]float64{0.3, -0.9, 2.1}), 3},
+		{randomTwo(), 3},
+	}
+
+	for _, tc := range cases {
+		k := synth.KAKDecompose(tc.g)
+		c := synth.DecomposeTwo(tc.g)
+
+		if k.CXCount() != tc.cnot || c.Metrics().Counts["CX"] != tc.cnot {
+			t.Fatalf("%v: %d CX", k.C, k.CXCount())
+		}
+
+		if !equalsUpToPhase(c.Unitary(false), tc.g.ToMat()) {
+			t.Fatalf("%v", k.C)
+		}
+	}
+
+	w := synth.WeylCoordinates(qsim.SWAP())
+	if math.Abs(w[0]-math.Pi/4) > 1e-9 || math.Abs(w[1]-math.Pi/4) > 1e-9 || math.Abs(w[2]-math.Pi/4) > 1e-9 {
+		t.Fail()
+	}
+}
+
+func TestNotControlled(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fail()
+		}
+	}()
+
+	synth.ControlledU(qsim.H().Tensor(qsim.H()))
+}
+
+// randomN returns a random n qubit gate.
+func randomN(n int) qsim.Gate {
+	c := qsim.NewCircuit(n)
+	for i := 0; i < 3*n; i++ {
+		for j := 0; j < n; j++ {
+			c.Apply(randomGate(), j)
+		}
+		c.CX(i%n, (i+1)%n)
+	}
+
+	return c.ToGate()
+}
+
+func TestDecompose(t *testing.T) {
+	gates := []qsim.Gate{randomGate(), randomTwo(), randomN(3), randomN(4), qsim.X().Tensor(qsim.SWAP())}
+
+	for _, g := range gates {
+		c := synth.Decompose(g)
+		if !equalsUpToPhase(c.Unitary(false), g.ToMat()) {
+			t.Fatalf("%d qubits", g.Size())
+		}
+
+		for _, inst := range c.Instructions() {
+			if len(inst.Controls)+len(inst.Targets) > 2 || (len(inst.Controls) == 1 && inst.Gate.Name() != "X") {
+				t.Fatalf("%v", inst)
+			}
+		}
+	}
+}
+
+func TestDecomposeNearlyUnitary(t *testing.T) {
+	// Within the tolerance of NewGate, but not exactly unitary.
+	m := randomN(3).ToMat()
+	m[0][1] += 2e-7
+	g := qsim.NewGate(m)
+
+	if !equalsUpToPhase(synth.Decompose(g).Unitary(false), g.ToMat()) {
+		t.Fail()
+	}
+}
+
+func TestMultiplexedRotation(t *testing.T) {
+	theta := []float64{0.1, -0.7, 1.3, 2.9}
+
+	for _, rot := range []func(float64) qsim.Gate{qsim.RY, qsim.RZ} {
+		ref := qsim.NewCircuit(3)
+		for j, th := range theta {
+			for b := 0; b < 2; b++ {
+				if j>>b&1 == 0 {
+					ref.X(b)
+				}
+			}
+			ref.Control(rot(th), []int{0, 1}, []int{2})
+			for b := 0; b < 2; b++ {
+				if j>>b&1 == 0 {
+					ref.X(b)
+				}
+			}
+		}
+
+		c := qsim.NewCircuit(3)
+		synth.MultiplexedRotation(c, rot, theta, []int{0, 1}, 2)
+		if !c.Unitary(false).Equals(ref.Unitary(false)) || c.Metrics().CXCount != 4 {
+			t.Fail()
+		}
+	}
+}
+
+func TestMCX(t *testing.T) {
+	for k := 0; k <= 4; k++ {
+		ctrls := make([]int, k)
+		for i := range ctrls {
+			ctrls[i] = i
+		}
+		n := k + 1 + k
+
+		ref := qsim.NewCircuit(n)
+		ref.Control(qsim.X(), ctrls, []int{k})
+		want := ref.Unitary(false)
+
+		c := qsim.NewCircuit(n)
+		synth.MCX(c, ctrls, k)
+		if !c.Unitary(false).Equals(want) {
+			t.Fatalf("MCX %d", k)
+		}
+
+		u := randomGate()
+		ref = qsim.NewCircuit(n)
+		ref.Control(u, ctrls, []int{k})
+		wantU := ref.Unitary(false)
+
+		c = qsim.NewCircuit(n)
+		synth.MCU(c, u, ctrls, k)
+		if !c.Unitary(false).Equals(wantU) {
+			t.Fatalf("MCU %d", k)
+		}
+
+		// With clean ancillas, compare columns where ancillas are |0>.
+		ancillas := make([]int, k)
+		for i := range ancillas {
+			ancillas[i] = k + 1 + i
+		}
+
+		c = qsim.NewCircuit(n)
+		synth.MCX(c, ctrls, k, ancillas...)
+		d := qsim.NewCircuit(n)
+		synth.MCU(d, u, ctrls, k, ancillas...)
+		got, gotU := c.Unitary(false), d.Unitary(false)
+		for j := 0; j < 1<<(k+1); j++ {
+			if !got.GetCol(j).Equals(want.GetCol(j)) || !gotU.GetCol(j).Equals(wantU.GetCol(j)) {
+				t.Fatalf("MCX with ancillas %d", k)
+			}
+		}
+	}
+}
+
+func TestSolovayKitaev(t *testing.T) {
+	g := randomGate()
+
+	// Distance may increase between consecutive depths, but converges quickly.
+	dist := make([]float64, 5)
+	for n := range dist {
+		s := synth.SolovayKitaev(g, n)
+		dist[n] = synth.Distance(g, s.Gate())
+
+		if !equalsUpToPhase(s.Circuit().Unitary(false), s.Gate().ToMat()) {
+			t.Fatalf("%v", s)
+		}
+	}
+	if dist[4] > 1e-3 || dist[4] > dist[1] {
+		t.Fatalf("%v", dist)
+	}
+
+	for _, epsilon := range []float64{1e-2, 1e-4} {
+		s := synth.ApproximateCliffordT(qsim.RX(0.123), epsilon)
+		if synth.Distance(qsim.RX(0.123), s.Gate()) > epsilon || s.TCount() == 0 {
+			t.Fatalf("%v", s)
+		}
+	}
+}
+
+func TestZRotation(t *testing.T) {
+	for k := -8; k <= 8; k++ {
+		s, ok := synth.ExactZ(float64(k) * math.Pi / 4)
+		if !ok || s.TCount() != k&1 || synth.Distance(s.Gate(), qsim.P(float64(k)*math.Pi/4)) > 1e-6 {
+			t.Fatalf("%d: %v", k, s)
+		}
+	}
+
+	if _, ok := synth.ExactZ(0.1); ok {
+		t.Fail()
+	}
+
+	s := synth.ZRotation(math.Pi/16, 1e-3)
+	if synth.Distance(s.Gate(), qsim.P(math.Pi/16)) > 1e-3 {
+		t.Fatalf("%v", s)
+	}
+
+	if !s.Dagger().Gate().ToMat().Mul(s.Gate().ToMat()).Equals(mat.NewId(2)) {
+		t.Fatalf("%v", s.Dagger())
+	}
+}
+
+func TestCliffordTCircuit(t *testing.T) {
+	c := qsim.NewCircuit(3)
+	c.H(0)
+	c.QFT(0, 1, 2)
+	c.T(2)
+
+	r := synth.CliffordTCircuit(c, 1e-5)
+	for _, inst := range r.Instructions() {
+		switch inst.Gate.Name() {
+		case "H", "S", "Sdg", "T", "Tdg", "Z", "X":
+		default:
+			t.Fatalf("%v", inst.Gate.Name())
+		}
+	}
+
+	if m := r.Metrics(); m.TCount == 0 || m.CXCount == 0 {
+		t.Fatalf("%v", m)
+	}
+
+	m := r.Unitary(false).Dagger().Mul(c.Unitary(false))
+	tr := 0i
+	for i := range m {
+		tr += m[i][i]
+	}
+	if o := cmplx.Abs(tr) / 8; o < 1-1e-6 {
+		t.Fatalf("%v", o)
+	}
+}
+
+func TestCliffordTCircuitNamed(t *testing.T) {
+	// Names do not decide how gates are synthesized.
+	c := qsim.NewCircuit(2)
+	c.H(0, 1)
+	c.Apply(qsim.NewNamedGate("P", qsim.P(0.3).ToMat()), 0)
+	c.Apply(qsim.NewNamedGate("RZ", qsim.S().ToMat()), 1)
+	c.Control(qsim.NewNamedGate("X", qsim.H().ToMat()), []int{0}, []int{1})
+
+	r := synth.CliffordTCircuit(c, 1e-5)
+	m := r.Unitary(false).Dagger().Mul(c.Unitary(false))
+	tr := 0i
+	for i := range m {
+		tr += m[i][i]
+	}
+	if o := cmplx.Abs(tr) / 4; o < 1-1e-6 {
+		t.Fatalf("%v", o)
+	}
+}
+
+func TestCliffordTCircuitLarge(t *testing.T) {
+	c := qsim.NewRecorder(64)
+	c.H(0)
+	c.CX(0, 63)
+	c.T(63)
+
+	r := synth.CliffordTCircuit(c, 1e-3)
+	if r.Size() != 64 || r.Metrics().TCount != 1 {
+		t.Fatalf("%v", r.Metrics())
+	}
+}
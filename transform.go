@@ -0,0 +1,162 @@
+package qsim
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// block is a run of recorded instructions, which is executed at once by a single kernel.
+type block struct {
+	count int              // Number of instructions.
+	apply func(c *Circuit) // Kernel equivalent to the instructions.
+}
+
+// fast records instructions emitted by emit, and executes them at once by kernel apply.
+// Instructions are recorded as usual unless NO_RECORD is set, so that inverting and transpiling see the gate level circuit.
+// If c only records, or is inside CIf, emit is executed as usual.
+func (c *Circuit) fast(emit func(), apply func(c *Circuit)) {
+	if c.norun || c.cond != nil {
+		emit()
+		return
+	}
+
+	start := len(c.insts)
+	func() {
+		c.norun = true
+		defer func() { c.norun = false }()
+		emit()
+	}()
+
+	if len(c.insts) == start {
+		return
+	}
+
+	if c.Option.NO_RECORD {
+		c.insts = c.insts[:start]
+		c.flush()
+		apply(c)
+		return
+	}
+
+	if c.blocks == nil {
+		c.blocks = make(map[int]block)
+	}
+	c.blocks[start] = block{count: len(c.insts) - start, apply: apply}
+
+	c.flush()
+	apply(c)
+}
+
+// whtBits is the maximum number of qubits transformed in a single sweep by hadamard.
+const whtBits = 10
+
+// hadamard applies H to every qubit of iregs by fast Walsh-Hadamard transform,
+// sweeping the state once for every whtBits qubits.
+func (v *vector[T]) hadamard(c *Circuit, iregs []int) {
+	for len(iregs) > 0 {
+		k := len(iregs)
+		if k > whtBits {
+			k = whtBits
+		}
+		v.transform(c, iregs[:k], wht[T])
+		iregs = iregs[k:]
+	}
+}
+
+// qft applies QFT to iregs by fast Fourier transform, where iregs[0] is the LSB.
+// If inverse is true, inverse QFT is applied.
+func (v *vector[T]) qft(c *Circuit, iregs []int, inverse bool) {
+	n := 1 << len(iregs)
+	sign := 1.0
+	if inverse {
+		sign = -1.0
+	}
+
+	twiddle := make([]T, n/2)
+	for j := range twiddle {
+		twiddle[j] = T(cmplx.Rect(1, sign*2*math.Pi*float64(j)/float64(n)))
+	}
+
+	v.transform(c, iregs, func(a []T) { fft(a, twiddle) })
+}
+
+// transform gathers 2^k amplitudes of iregs for each value of the other qubits,
+// and replaces them by f applied in place. Bit i of the index of f is iregs[i].
+// If iregs are the lowest qubits in order, amplitudes are already contiguous, and f is applied without copying.
+func (v *vector[T]) transform(c *Circuit, iregs []int, f func(a []T)) {
+	offs := offsets(iregs)
+	mask := bitmask(iregs)
+
+	contiguous := true
+	for i, q := range iregs {
+		contiguous = contiguous && i == q
+	}
+
+	c.bases(0, mask, func(base, count int) {
+		if contiguous {
+			for j := 0; j < count; j++ {
+				f(v.data[base : base+len(offs)])
+				base += len(offs)
+			}
+			return
+		}
+
+		a := make([]T, len(offs))
+		for j := 0; j < count; j++ {
+			for x, o := range offs {
+				a[x] = v.data[base|o]
+			}
+			f(a)
+			for x, o := range offs {
+				v.data[base|o] = a[x]
+			}
+			base = next(base, mask, 0)
+		}
+	})
+}
+
+// wht applies normalized Walsh-Hadamard transform to a in place.
+func wht[T amplitude](a []T) {
+	for h := 1; h < len(a); h <<= 1 {
+		for i := 0; i < len(a); i += h << 1 {
+			for j := i; j < i+h; j++ {
+				a[j], a[j+h] = a[j]+a[j+h], a[j]-a[j+h]
+			}
+		}
+	}
+
+	scale := T(complex(1/math.Sqrt(float64(len(a))), 0))
+	for i := range a {
+		a[i] *= scale
+	}
+}
+
+// fft applies normalized discrete Fourier transform to a in place,
+// where twiddle[j] is the len(a)-th root of unity to the power of j.
+func fft[T amplitude](a []T, twiddle []T) {
+	n := len(a)
+	shift := bits.UintSize - bits.Len(uint(n-1))
+	if n > 1 {
+		for i := range a {
+			if j := int(bits.Reverse(uint(i)) >> shift); i < j {
+				a[i], a[j] = a[j], a[i]
+			}
+		}
+	}
+
+	for h := 1; h < n; h <<= 1 {
+		step := n / (h << 1)
+		for i := 0; i < n; i += h << 1 {
+			for j := 0; j < h; j++ {
+				u, v := a[i+j], a[i+j+h]*twiddle[j*step]
+				a[i+j], a[i+j+h] = u+v, u-v
+			}
+		}
+	}
+
+	scale := T(complex(1/math.Sqrt(float64(n)), 0))
+	for i := range a {
+		a[i] *= scale
+	}
+}
@@ -0,0 +1,167 @@
+package transpile
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/synth"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// translator translates gates to a basis.
+type translator struct {
+	basis map[string]bool
+}
+
+// BasisTranslation returns a pass which translates every gate to basis, up to the global phase.
+// Uncontrolled gates are named as usual, such as "H", "RZ", "SX", "U3", and
+// singly controlled gates are named with "C" prefix, such as "CX" and "CZ".
+// basis should contain "CX" or "CZ", and one of {"U3"}, {"RZ", "SX"}, {"RZ", "RY"} or {"RZ", "RX"}.
+// Measurements, resets and barriers are kept. Oracles cannot be translated.
+func BasisTranslation(basis ...string) Pass {
+	t := translator{basis: make(map[string]bool, len(basis))}
+	for _, b := range basis {
+		t.basis[b] = true
+	}
+
+	if !t.basis["CX"] && !t.basis["CZ"] {
+		panic("Basis should contain CX or CZ.")
+	}
+	if !t.basis["U3"] && !(t.basis["RZ"] && (t.basis["SX"] || t.basis["RY"] || t.basis["RX"])) {
+		panic("Basis cannot express one qubit gates.")
+	}
+
+	return pass{name: "BasisTranslation", run: t.run}
+}
+
+// run translates every instruction.
+func (t translator) run(insts []qsim.Instruction) []qsim.Instruction {
+	r := make([]qsim.Instruction, 0, len(insts))
+	for _, inst := range insts {
+		switch inst.Kind {
+		case qsim.KindGate:
+			r = append(r, t.gate(inst)...)
+		case qsim.KindOracle, qsim.KindPhaseOracle:
+			panic("Oracles cannot be translated.")
+		default:
+			r = append(r, inst)
+		}
+	}
+
+	return r
+}
+
+// allowed checks if inst is in the basis.
+func (t translator) allowed(inst qsim.Instruction) bool {
+	switch len(inst.Controls) {
+	case 0:
+		return t.basis[inst.Gate.Name()]
+	case 1:
+		return inst.Gate.Size() == 1 && t.basis["C"+inst.Gate.Name()]
+	}
+
+	return false
+}
+
+// instructionsOf returns instructions of c, with qubit i mapped to qubits[i] and condition cond.
+func instructionsOf(c *qsim.Circuit, qubits []int, cond *qsim.Condition) []qsim.Instruction {
+	remap := func(qs []int) []int {
+		r := make([]int, len(qs))
+		for i, q := range qs {
+			r[i] = qubits[q]
+		}
+		return r
+	}
+
+	insts := c.Instructions()
+	for i := range insts {
+		insts[i].Controls = remap(insts[i].Controls)
+		insts[i].Targets = remap(insts[i].Targets)
+		insts[i].Cond = cond
+	}
+
+	return insts
+}
+
+// gate translates gate instruction inst.
+func (t translator) gate(inst qsim.Instruction) []qsim.Instruction {
+	if t.allowed(inst) {
+		return []qsim.Instruction{inst}
+	}
+
+	g, k := inst.Gate, len(inst.Controls)
+	qubits := append(append([]int{}, inst.Controls...), inst.Targets...)
+	ctrls, targets := slice.Range(0, k), slice.Range(k, len(qubits))
+
+	// Decompose into CX and one qubit gates, where qubit i is qubits[i].
+	c := qsim.NewCircuit(len(qubits))
+	switch {
+	case k == 0 && g.Size() == 1:
+		return t.one(g, inst.Targets[0], inst.Cond)
+	case k == 0 && g.Name() == "SWAP":
+		c.CX(0, 1)
+		c.CX(1, 0)
+		c.CX(0, 1)
+	case k == 0:
+		c = synth.Decompose(g)
+	case k == 1 && g.Name() == "X":
+		// CX = H CZ H, since CX is not in the basis.
+		c.H(1)
+		c.Control(qsim.Z(), []int{0}, []int{1})
+		c.H(1)
+	case g.Size() == 1 && g.Name() == "X":
+		synth.MCX(c, ctrls, targets[0])
+	case g.Size() == 1:
+		synth.MCU(c, g, ctrls, targets[0])
+	default:
+		full := qsim.NewCircuit(len(qubits))
+		full.Control(g, ctrls, targets)
+		c = synth.Decompose(full.ToGate())
+	}
+
+	r := make([]qsim.Instruction, 0)
+	for _, d := range instructionsOf(c, qubits, inst.Cond) {
+		r = append(r, t.gate(d)...)
+	}
+
+	return r
+}
+
+// one translates one qubit gate g on qubit q.
+func (t translator) one(g qsim.Gate, q int, cond *qsim.Condition) []qsim.Instruction {
+	c := qsim.NewCircuit(1)
+
+	switch {
+	case t.basis[g.Name()]:
+		c.Apply(g, 0)
+	case t.basis["U3"]:
+		p := synth.U3(g)
+		c.U3(p.Theta, p.Phi, p.Lambda, 0)
+	case t.basis["RZ"] && t.basis["SX"]:
+		p := synth.U3(g)
+		if math.Abs(math.Sin(p.Theta/2)) < eps {
+			// Diagonal gates are RZ up to the global phase.
+			c.RZ(p.Phi+p.Lambda, 0)
+			break
+		}
+		if t.basis["X"] && math.Abs(cmplx.Abs(g.At(0, 1))-1) < eps {
+			// Anti-diagonal gates are X RZ up to the global phase.
+			c.RZ(p.Lambda-p.Phi+math.Pi, 0)
+			c.X(0)
+			break
+		}
+		// U3(t, p, l) = RZ(p+pi) SX RZ(t+pi) SX RZ(l) up to the global phase.
+		c.RZ(p.Lambda, 0)
+		c.SX(0)
+		c.RZ(p.Theta+math.Pi, 0)
+		c.SX(0)
+		c.RZ(p.Phi+math.Pi, 0)
+	case t.basis["RZ"] && t.basis["RY"]:
+		c = synth.ZYZ(g).Circuit()
+	default:
+		c = synth.ZXZ(g).Circuit()
+	}
+
+	return instructionsOf(c, []int{q}, cond)
+}
@@ -0,0 +1,189 @@
+package transpile
+
+import (
+	"math"
+)
+
+// CouplingMap is an undirected graph of physical qubits, where two qubit gates can act only on connected qubits.
+type CouplingMap struct {
+	adj  [][]int
+	dist [][]int
+}
+
+// NewCouplingMap returns a CouplingMap of n qubits with edges.
+func NewCouplingMap(n int, edges [][2]int) *CouplingMap {
+	cm := &CouplingMap{adj: make([][]int, n)}
+
+	for _, e := range edges {
+		a, b := e[0], e[1]
+		if a < 0 || a >= n || b < 0 || b >= n {
+			panic("Qubit index out of range.")
+		}
+		if a == b {
+			panic("Self loop is not allowed.")
+		}
+		if cm.Connected(a, b) {
+			continue
+		}
+
+		cm.adj[a] = append(cm.adj[a], b)
+		cm.adj[b] = append(cm.adj[b], a)
+	}
+
+	// Distances by breadth first search from each qubit.
+	cm.dist = make([][]int, n)
+	for s := range cm.dist {
+		d := make([]int, n)
+		for i := range d {
+			d[i] = math.MaxInt32
+		}
+		d[s] = 0
+
+		queue := []int{s}
+		for len(queue) > 0 {
+			q := queue[0]
+			queue = queue[1:]
+			for _, r := range cm.adj[q] {
+				if d[r] == math.MaxInt32 {
+					d[r] = d[q] + 1
+					queue = append(queue, r)
+				}
+			}
+		}
+		cm.dist[s] = d
+	}
+
+	return cm
+}
+
+// Line returns a CouplingMap of n qubits in a line.
+func Line(n int) *CouplingMap {
+	edges := make([][2]int, 0, n)
+	for i := 0; i+1 < n; i++ {
+		edges = append(edges, [2]int{i, i + 1})
+	}
+
+	return NewCouplingMap(n, edges)
+}
+
+// Ring returns a CouplingMap of n qubits in a ring.
+func Ring(n int) *CouplingMap {
+	edges := make([][2]int, 0, n)
+	for i := 0; i < n; i++ {
+		if j := (i + 1) % n; i != j {
+			edges = append(edges, [2]int{i, j})
+		}
+	}
+
+	return NewCouplingMap(n, edges)
+}
+
+// Grid returns a CouplingMap of rows x cols qubits in a grid, where qubit (r, c) is r*cols + c.
+func Grid(rows, cols int) *CouplingMap {
+	edges := make([][2]int, 0, 2*rows*cols)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			q := r*cols + c
+			if c+1 < cols {
+				edges = append(edges, [2]int{q, q + 1})
+			}
+			if r+1 < rows {
+				edges = append(edges, [2]int{q, q + cols})
+			}
+		}
+	}
+
+	return NewCouplingMap(rows*cols, edges)
+}
+
+// HeavyHex returns a CouplingMap of heavy-hex lattice with rows x cols hexagons,
+// where every edge of the hexagonal lattice has an additional qubit in the middle.
+// Qubits on the hexagonal lattice come first, row by row.
+func HeavyHex(rows, cols int) *CouplingMap {
+	// Hexagonal lattice as a brick wall: rows+1 lines of 2*cols+2 qubits,
+	// where lines r and r+1 are connected at columns c with c = r mod 2.
+	width := 2*cols + 2
+	hex := make([][2]int, 0)
+	for r := 0; r <= rows; r++ {
+		for c := 0; c < width; c++ {
+			q := r*width + c
+			if c+1 < width {
+				hex = append(hex, [2]int{q, q + 1})
+			}
+			if r < rows && c%2 == r%2 {
+				hex = append(hex, [2]int{q, q + width})
+			}
+		}
+	}
+
+	n := (rows + 1) * width
+	edges := make([][2]int, 0, 2*len(hex))
+	for i, e := range hex {
+		m := n + i
+		edges = append(edges, [2]int{e[0], m}, [2]int{m, e[1]})
+	}
+
+	return NewCouplingMap(n+len(hex), edges)
+}
+
+// Size returns the number of physical qubits.
+func (cm *CouplingMap) Size() int {
+	return len(cm.adj)
+}
+
+// Connected checks if qubits a and b are connected.
+func (cm *CouplingMap) Connected(a, b int) bool {
+	for _, q := range cm.adj[a] {
+		if q == b {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Neighbors returns qubits connected to q.
+func (cm *CouplingMap) Neighbors(q int) []int {
+	return append([]int{}, cm.adj[q]...)
+}
+
+// Edges returns every edge (a, b) with a < b.
+func (cm *CouplingMap) Edges() [][2]int {
+	r := make([][2]int, 0)
+	for a, qs := range cm.adj {
+		for _, b := range qs {
+			if a < b {
+				r = append(r, [2]int{a, b})
+			}
+		}
+	}
+
+	return r
+}
+
+// Distance returns the length of the shortest path between a and b.
+// Panics if a and b are not connected by any path.
+func (cm *CouplingMap) Distance(a, b int) int {
+	d := cm.dist[a][b]
+	if d == math.MaxInt32 {
+		panic("Qubits are not connected.")
+	}
+
+	return d
+}
+
+// ShortestPath returns a shortest path from a to b, including both ends.
+func (cm *CouplingMap) ShortestPath(a, b int) []int {
+	path := []int{a}
+	for q := a; q != b; {
+		for _, r := range cm.adj[q] {
+			if cm.Distance(r, b) < cm.Distance(q, b) {
+				q = r
+				break
+			}
+		}
+		path = append(path, q)
+	}
+
+	return path
+}
@@ -0,0 +1,304 @@
+package transpile
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// Tolerance for comparing matrices.
+const eps = 1e-9
+
+// maxCommuteQubits is the maximum number of qubits for checking commutation by matrices.
+const maxCommuteQubits = 6
+
+// qubitsOf returns every qubit that inst acts on.
+func qubitsOf(inst qsim.Instruction) []int {
+	r := append([]int{}, inst.Controls...)
+	r = append(r, inst.Targets...)
+	return append(r, inst.Outputs...)
+}
+
+// isGate checks if inst is an unconditioned gate.
+func isGate(inst qsim.Instruction) bool {
+	return inst.Kind == qsim.KindGate && inst.Cond == nil
+}
+
+// phaseOf returns p with a = p b if a is b up to the phase. Otherwise, it returns 0.
+func phaseOf(a, b mat.Mat) complex128 {
+	bi, bj := 0, 0
+	for i := range b {
+		for j := range b[i] {
+			if cmplx.Abs(b[i][j]) > cmplx.Abs(b[bi][bj]) {
+				bi, bj = i, j
+			}
+		}
+	}
+
+	p := a[bi][bj] / b[bi][bj]
+	if math.Abs(cmplx.Abs(p)-1) > eps || !a.Equals(b.ScalarMul(p)) {
+		return 0
+	}
+
+	return p
+}
+
+// isIdentity checks if inst is the identity gate.
+// Uncontrolled gates may differ by the global phase.
+func isIdentity(inst qsim.Instruction) bool {
+	if !isGate(inst) {
+		return false
+	}
+
+	id := mat.NewId(1 << inst.Gate.Size())
+	if len(inst.Controls) == 0 {
+		return phaseOf(inst.Gate.ToMat(), id) != 0
+	}
+
+	return inst.Gate.ToMat().Equals(id)
+}
+
+// sameWires checks if a and b are gates with same controls and targets.
+func sameWires(a, b qsim.Instruction) bool {
+	if !isGate(a) || !isGate(b) || len(a.Controls) != len(b.Controls) || len(a.Targets) != len(b.Targets) {
+		return false
+	}
+
+	for i := range a.Targets {
+		if a.Targets[i] != b.Targets[i] {
+			return false
+		}
+	}
+
+	ac, bc := append([]int{}, a.Controls...), append([]int{}, b.Controls...)
+	sort.Ints(ac)
+	sort.Ints(bc)
+	for i := range ac {
+		if ac[i] != bc[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isInverse checks if b is the inverse of a.
+func isInverse(a, b qsim.Instruction) bool {
+	if !sameWires(a, b) {
+		return false
+	}
+
+	m := b.Gate.ToMat().Mul(a.Gate.ToMat())
+	inst := b.Copy()
+	inst.Gate = qsim.NewGate(m)
+
+	return isIdentity(inst)
+}
+
+// isDiagonal checks if inst is a diagonal gate. Controlled diagonal gates are also diagonal.
+func isDiagonal(inst qsim.Instruction) bool {
+	m := inst.Gate.ToMat()
+	for i := range m {
+		for j := range m[i] {
+			if i != j && cmplx.Abs(m[i][j]) > eps {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// matrixOn returns the matrix of gate inst on qubits.
+func matrixOn(inst qsim.Instruction, qubits []int) mat.Mat {
+	index := make(map[int]int, len(qubits))
+	for i, q := range qubits {
+		index[q] = i
+	}
+	remap := func(qs []int) []int {
+		r := make([]int, len(qs))
+		for i, q := range qs {
+			r[i] = index[q]
+		}
+		return r
+	}
+
+	c := qsim.NewCircuit(len(qubits))
+	c.Control(inst.Gate, remap(inst.Controls), remap(inst.Targets))
+
+	return c.Unitary(false)
+}
+
+// commutes checks if a and b commute.
+func commutes(a, b qsim.Instruction) bool {
+	if !slice.HasCommon(qubitsOf(a), qubitsOf(b)) {
+		return true
+	}
+
+	if !isGate(a) || !isGate(b) {
+		return false
+	}
+
+	if isDiagonal(a) && isDiagonal(b) {
+		return true
+	}
+
+	qubits := qubitsOf(a)
+	for _, q := range qubitsOf(b) {
+		if !slice.Contains(qubits, q) {
+			qubits = append(qubits, q)
+		}
+	}
+	if len(qubits) > maxCommuteQubits {
+		return false
+	}
+
+	ma, mb := matrixOn(a, qubits), matrixOn(b, qubits)
+	return ma.Mul(mb).Equals(mb.Mul(ma))
+}
+
+// combiner tries to combine a with the following instruction b.
+// If possible, it returns the combined instruction and true. nil means that a and b cancel out.
+type combiner func(a, b qsim.Instruction) (*qsim.Instruction, bool)
+
+// peephole combines each gate with the previous instruction acting on the same qubits.
+// If commute is true, the previous instructions commuting with the gate are skipped.
+func peephole(insts []qsim.Instruction, f combiner, commute bool) []qsim.Instruction {
+	out := make([]*qsim.Instruction, 0, len(insts))
+
+	for _, inst := range insts {
+		inst := inst.Copy()
+		combined := false
+
+		if isGate(inst) {
+			for j := len(out) - 1; j >= 0; j-- {
+				p := out[j]
+				if p == nil || !slice.HasCommon(qubitsOf(*p), qubitsOf(inst)) {
+					continue
+				}
+
+				if r, ok := f(*p, inst); ok {
+					out[j] = r
+					combined = true
+					break
+				}
+
+				if !commute || !commutes(*p, inst) {
+					break
+				}
+			}
+		}
+
+		if !combined {
+			out = append(out, &inst)
+		}
+	}
+
+	r := make([]qsim.Instruction, 0, len(out))
+	for _, p := range out {
+		if p != nil {
+			r = append(r, *p)
+		}
+	}
+
+	return r
+}
+
+// cancel cancels a and b if b is the inverse of a.
+func cancel(a, b qsim.Instruction) (*qsim.Instruction, bool) {
+	return nil, isInverse(a, b)
+}
+
+// rotations are rotation gates which can be merged.
+var rotations = map[string]func(float64) qsim.Gate{
+	"P":  qsim.P,
+	"RX": qsim.RX,
+	"RY": qsim.RY,
+	"RZ": qsim.RZ,
+}
+
+// merge merges a and b if they are same rotations on same qubits.
+func merge(a, b qsim.Instruction) (*qsim.Instruction, bool) {
+	rot, ok := rotations[a.Gate.Name()]
+	if !ok || a.Gate.Name() != b.Gate.Name() || !sameWires(a, b) {
+		return nil, false
+	}
+
+	// Gates from NewNamedGate may reuse the names without carrying the angle.
+	if len(a.Gate.Params()) != 1 || len(b.Gate.Params()) != 1 {
+		return nil, false
+	}
+
+	r := a.Copy()
+	r.Gate = rot(a.Gate.Params()[0] + b.Gate.Params()[0])
+	if isIdentity(r) {
+		return nil, true
+	}
+
+	return &r, true
+}
+
+// pass is a Pass from a function.
+type pass struct {
+	name string
+	run  func([]qsim.Instruction) []qsim.Instruction
+}
+
+// Name implements the Pass interface.
+func (p pass) Name() string {
+	return p.name
+}
+
+// Run implements the Pass interface.
+func (p pass) Run(insts []qsim.Instruction) []qsim.Instruction {
+	return p.run(insts)
+}
+
+// RemoveIdentities returns a pass which removes identity gates.
+// Uncontrolled gates are removed if they are the identity up to the global phase.
+func RemoveIdentities() Pass {
+	return pass{name: "RemoveIdentities", run: func(insts []qsim.Instruction) []qsim.Instruction {
+		r := make([]qsim.Instruction, 0, len(insts))
+		for _, inst := range insts {
+			if !isIdentity(inst) {
+				r = append(r, inst)
+			}
+		}
+		return r
+	}}
+}
+
+// CancelInverses returns a pass which removes adjacent gates that are inverses of each other,
+// such as H H or CX CX.
+func CancelInverses() Pass {
+	return pass{name: "CancelInverses", run: func(insts []qsim.Instruction) []qsim.Instruction {
+		return peephole(insts, cancel, false)
+	}}
+}
+
+// MergeRotations returns a pass which merges adjacent rotations on same qubits,
+// such as P(a) P(b) = P(a+b). Rotations are P, RX, RY and RZ gates, possibly controlled.
+func MergeRotations() Pass {
+	return pass{name: "MergeRotations", run: func(insts []qsim.Instruction) []qsim.Instruction {
+		return peephole(insts, merge, false)
+	}}
+}
+
+// CommutativeCancellation returns a pass which cancels inverses and merges rotations,
+// skipping gates in between that commute with them.
+func CommutativeCancellation() Pass {
+	f := func(a, b qsim.Instruction) (*qsim.Instruction, bool) {
+		if r, ok := merge(a, b); ok {
+			return r, true
+		}
+		return cancel(a, b)
+	}
+
+	return pass{name: "CommutativeCancellation", run: func(insts []qsim.Instruction) []qsim.Instruction {
+		return peephole(insts, f, true)
+	}}
+}
@@ -0,0 +1,371 @@
+package transpile
+
+import (
+	"math"
+	"sort"
+
+	"github.com/sp301415/qsim"
+)
+
+// layout is a bijection between logical and physical qubits.
+type layout struct {
+	phys []int // phys[l] is the physical qubit of logical qubit l.
+	logi []int // logi[p] is the logical qubit on physical qubit p.
+}
+
+// trivialLayout returns a layout of n qubits, where logical qubit i is physical qubit i.
+func trivialLayout(n int) layout {
+	l := layout{phys: make([]int, n), logi: make([]int, n)}
+	for i := 0; i < n; i++ {
+		l.phys[i], l.logi[i] = i, i
+	}
+
+	return l
+}
+
+// copy returns a copy of l.
+func (l layout) copy() layout {
+	return layout{phys: append([]int{}, l.phys...), logi: append([]int{}, l.logi...)}
+}
+
+// swap swaps logical qubits on physical qubits p0 and p1.
+func (l layout) swap(p0, p1 int) {
+	l0, l1 := l.logi[p0], l.logi[p1]
+	l.logi[p0], l.logi[p1] = l1, l0
+	l.phys[l0], l.phys[l1] = p1, p0
+}
+
+// apply returns inst acting on physical qubits.
+func (l layout) apply(inst qsim.Instruction) qsim.Instruction {
+	remap := func(qs []int) []int {
+		r := make([]int, len(qs))
+		for i, q := range qs {
+			r[i] = l.phys[q]
+		}
+		return r
+	}
+
+	inst = inst.Copy()
+	inst.Controls = remap(inst.Controls)
+	inst.Targets = remap(inst.Targets)
+	inst.Outputs = remap(inst.Outputs)
+
+	return inst
+}
+
+// swapInstruction returns SWAP on physical qubits p0 and p1.
+func swapInstruction(p0, p1 int) qsim.Instruction {
+	return qsim.Instruction{Kind: qsim.KindGate, Gate: qsim.SWAP(), Targets: []int{p0, p1}}
+}
+
+// Routing is a pass which inserts SWAP gates, so that every two qubit gate acts on connected physical qubits.
+// Logical qubit i starts at physical qubit InitialLayout()[i], and ends at FinalLayout()[i].
+// Circuits should have as many qubits as the coupling map, and gates should act on at most two qubits.
+// NewRecorder can be used to route circuits too large to simulate, such as small circuits on large devices.
+type Routing struct {
+	coupling *CouplingMap
+	sabre    bool
+
+	initial []int
+	final   []int
+	swaps   int
+}
+
+// BasicSwap returns a Routing which starts from the trivial layout,
+// and moves qubits along the shortest path whenever a gate acts on disconnected qubits.
+func BasicSwap(cm *CouplingMap) *Routing {
+	return &Routing{coupling: cm}
+}
+
+// Sabre returns a Routing using SABRE algorithm of Li, Ding and Xie.
+// It chooses SWAP gates by the distances of front and upcoming gates,
+// and the initial layout is found by routing the circuit forward and backward.
+func Sabre(cm *CouplingMap) *Routing {
+	return &Routing{coupling: cm, sabre: true}
+}
+
+// Name implements the Pass interface.
+func (r *Routing) Name() string {
+	if r.sabre {
+		return "Sabre"
+	}
+	return "BasicSwap"
+}
+
+// qubits implements the sized interface.
+func (r *Routing) qubits() int {
+	return r.coupling.Size()
+}
+
+// InitialLayout returns the physical qubit of each logical qubit at the start of the last run.
+func (r *Routing) InitialLayout() []int {
+	return append([]int{}, r.initial...)
+}
+
+// FinalLayout returns the physical qubit of each logical qubit at the end of the last run.
+func (r *Routing) FinalLayout() []int {
+	return append([]int{}, r.final...)
+}
+
+// Swaps returns the number of SWAP gates inserted in the last run.
+func (r *Routing) Swaps() int {
+	return r.swaps
+}
+
+// Run implements the Pass interface.
+func (r *Routing) Run(insts []qsim.Instruction) []qsim.Instruction {
+	n := r.coupling.Size()
+	for _, inst := range insts {
+		qs := qubitsOf(inst)
+		for _, q := range qs {
+			if q >= n {
+				panic("Circuit has more qubits than the coupling map.")
+			}
+		}
+
+		if (inst.Kind == qsim.KindGate || inst.Kind == qsim.KindOracle || inst.Kind == qsim.KindPhaseOracle) && len(qs) > 2 {
+			panic("Gates on more than two qubits should be decomposed first.")
+		}
+	}
+
+	l := trivialLayout(n)
+	var out []qsim.Instruction
+
+	if r.sabre {
+		rev := make([]qsim.Instruction, len(insts))
+		for i, inst := range insts {
+			rev[len(insts)-1-i] = inst
+		}
+
+		for i := 0; i < 2; i++ {
+			_, l = r.sabreRoute(insts, l.copy())
+			_, l = r.sabreRoute(rev, l.copy())
+		}
+
+		r.initial = append([]int{}, l.phys...)
+		r.swaps = 0
+		out, l = r.sabreRoute(insts, l)
+	} else {
+		r.initial = append([]int{}, l.phys...)
+		r.swaps = 0
+		out = r.basicRoute(insts, l)
+	}
+	r.final = append([]int{}, l.phys...)
+
+	return out
+}
+
+// isTwoQubit checks if inst is a gate acting on two qubits.
+func isTwoQubit(inst qsim.Instruction) bool {
+	return (inst.Kind == qsim.KindGate || inst.Kind == qsim.KindOracle || inst.Kind == qsim.KindPhaseOracle) && len(qubitsOf(inst)) == 2
+}
+
+// routePath inserts SWAP gates along the shortest path, so that physical qubits p0 and p1 become connected.
+func (r *Routing) routePath(out []qsim.Instruction, l layout, p0, p1 int) []qsim.Instruction {
+	path := r.coupling.ShortestPath(p0, p1)
+	for i := 0; i+2 < len(path); i++ {
+		out = append(out, swapInstruction(path[i], path[i+1]))
+		l.swap(path[i], path[i+1])
+		r.swaps++
+	}
+
+	return out
+}
+
+// basicRoute routes insts by moving qubits along the shortest path. l is updated to the final layout.
+func (r *Routing) basicRoute(insts []qsim.Instruction, l layout) []qsim.Instruction {
+	out := make([]qsim.Instruction, 0, len(insts))
+	for _, inst := range insts {
+		if isTwoQubit(inst) {
+			qs := qubitsOf(inst)
+			p0, p1 := l.phys[qs[0]], l.phys[qs[1]]
+			if !r.coupling.Connected(p0, p1) {
+				out = r.routePath(out, l, p0, p1)
+			}
+		}
+		out = append(out, l.apply(inst))
+	}
+
+	return out
+}
+
+// Parameters of SABRE.
+const (
+	sabreExtendedSize   = 20    // Maximum number of gates in the extended set.
+	sabreExtendedWeight = 0.5   // Weight of the extended set.
+	sabreDecayDelta     = 0.001 // Increment of decay for swapped qubits.
+	sabreDecayReset     = 5     // Number of swaps before resetting decay.
+)
+
+// sabreRoute routes insts starting from l, and returns routed instructions and the final layout.
+func (r *Routing) sabreRoute(insts []qsim.Instruction, l layout) ([]qsim.Instruction, layout) {
+	n := r.coupling.Size()
+
+	// Dependency graph, where instructions sharing qubits or classical bits are ordered.
+	preds := make([]int, len(insts))
+	succs := make([][]int, len(insts))
+	last := make(map[int]int)
+	for i, inst := range insts {
+		wires := qubitsOf(inst)
+		for _, b := range inst.Cbits {
+			wires = append(wires, n+b)
+		}
+		if inst.Cond != nil {
+			for _, b := range inst.Cond.Cbits {
+				wires = append(wires, n+b)
+			}
+		}
+
+		seen := make(map[int]bool)
+		for _, w := range wires {
+			if j, ok := last[w]; ok && !seen[j] {
+				seen[j] = true
+				preds[i]++
+				succs[j] = append(succs[j], i)
+			}
+			last[w] = i
+		}
+	}
+
+	front := make([]int, 0)
+	for i := range insts {
+		if preds[i] == 0 {
+			front = append(front, i)
+		}
+	}
+
+	dist := func(inst qsim.Instruction, l layout) int {
+		qs := qubitsOf(inst)
+		return r.coupling.Distance(l.phys[qs[0]], l.phys[qs[1]])
+	}
+
+	out := make([]qsim.Instruction, 0, len(insts))
+	decay := make([]float64, n)
+	resetDecay := func() {
+		for i := range decay {
+			decay[i] = 1
+		}
+	}
+	resetDecay()
+	stuck, swaps := 0, 0
+
+	for len(front) > 0 {
+		// Execute every executable instruction in the front layer.
+		next := make([]int, 0, len(front))
+		executed := false
+		for _, i := range front {
+			if isTwoQubit(insts[i]) && dist(insts[i], l) > 1 {
+				next = append(next, i)
+				continue
+			}
+
+			out = append(out, l.apply(insts[i]))
+			executed = true
+			for _, j := range succs[i] {
+				preds[j]--
+				if preds[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+		sort.Ints(next)
+		front = next
+
+		if executed {
+			resetDecay()
+			stuck = 0
+			continue
+		}
+
+		// If no progress is made for too long, route the first gate along the shortest path.
+		if stuck > 10*n {
+			qs := qubitsOf(insts[front[0]])
+			out = r.routePath(out, l, l.phys[qs[0]], l.phys[qs[1]])
+			stuck = 0
+			continue
+		}
+
+		// Extended set of upcoming two qubit gates.
+		extended := make([]int, 0, sabreExtendedSize)
+		visited := make(map[int]bool)
+		queue := append([]int{}, front...)
+		for len(queue) > 0 && len(extended) < sabreExtendedSize {
+			i := queue[0]
+			queue = queue[1:]
+			for _, j := range succs[i] {
+				if visited[j] {
+					continue
+				}
+				visited[j] = true
+				if isTwoQubit(insts[j]) {
+					extended = append(extended, j)
+				}
+				queue = append(queue, j)
+			}
+		}
+
+		// Candidate swaps are edges touching qubits of the front layer.
+		candidates := make([][2]int, 0)
+		seen := make(map[[2]int]bool)
+		for _, i := range front {
+			for _, q := range qubitsOf(insts[i]) {
+				p := l.phys[q]
+				for _, nb := range r.coupling.adj[p] {
+					e := [2]int{p, nb}
+					if nb < p {
+						e = [2]int{nb, p}
+					}
+					if !seen[e] {
+						seen[e] = true
+						candidates = append(candidates, e)
+					}
+				}
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if candidates[i][0] != candidates[j][0] {
+				return candidates[i][0] < candidates[j][0]
+			}
+			return candidates[i][1] < candidates[j][1]
+		})
+
+		best, bestScore := candidates[0], math.Inf(1)
+		for _, e := range candidates {
+			t := l.copy()
+			t.swap(e[0], e[1])
+
+			score := 0.0
+			for _, i := range front {
+				score += float64(dist(insts[i], t))
+			}
+			score /= float64(len(front))
+
+			if len(extended) > 0 {
+				ext := 0.0
+				for _, i := range extended {
+					ext += float64(dist(insts[i], t))
+				}
+				score += sabreExtendedWeight * ext / float64(len(extended))
+			}
+
+			score *= math.Max(decay[e[0]], decay[e[1]])
+			if score < bestScore {
+				best, bestScore = e, score
+			}
+		}
+
+		out = append(out, swapInstruction(best[0], best[1]))
+		l.swap(best[0], best[1])
+		r.swaps++
+		decay[best[0]] += sabreDecayDelta
+		decay[best[1]] += sabreDecayDelta
+
+		swaps++
+		stuck++
+		if swaps%sabreDecayReset == 0 {
+			resetDecay()
+		}
+	}
+
+	return out, l
+}
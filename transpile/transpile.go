@@ -0,0 +1,109 @@
+// Package transpile rewrites recorded circuits by passes, which preserve the unitary up to the global phase.
+// Passes are run by a PassManager, and the result is rebuilt by Circuit.Rebuild.
+package transpile
+
+import (
+	"fmt"
+
+	"github.com/sp301415/qsim"
+)
+
+// Pass is a transformation of instructions, which preserves the unitary up to the global phase.
+type Pass interface {
+	// Name returns the name of the pass.
+	Name() string
+	// Run returns transformed instructions.
+	Run(insts []qsim.Instruction) []qsim.Instruction
+}
+
+// PassManager runs passes in order.
+type PassManager struct {
+	passes []Pass
+}
+
+// NewPassManager returns a new PassManager with passes.
+func NewPassManager(passes ...Pass) *PassManager {
+	return &PassManager{passes: append([]Pass{}, passes...)}
+}
+
+// Append appends passes to pm.
+func (pm *PassManager) Append(passes ...Pass) {
+	pm.passes = append(pm.passes, passes...)
+}
+
+// Passes returns the names of passes.
+func (pm *PassManager) Passes() []string {
+	r := make([]string, len(pm.passes))
+	for i, p := range pm.passes {
+		r[i] = p.Name()
+	}
+
+	return r
+}
+
+// sized is implemented by passes which need circuits of a fixed number of qubits, such as Routing.
+type sized interface {
+	qubits() int
+}
+
+// Run runs every pass on instructions of c, and returns the new circuit.
+func (pm *PassManager) Run(c *qsim.Circuit) *qsim.Circuit {
+	for _, p := range pm.passes {
+		if s, ok := p.(sized); ok && s.qubits() != c.Size() {
+			panic(fmt.Sprintf("%s needs a circuit of %d qubits, but the circuit has %d qubits.", p.Name(), s.qubits(), c.Size()))
+		}
+	}
+
+	insts := c.Instructions()
+	for _, p := range pm.passes {
+		insts = p.Run(insts)
+	}
+
+	return c.Rebuild(insts)
+}
+
+// fixpoint runs passes repeatedly until the number of instructions does not decrease.
+type fixpoint struct {
+	passes []Pass
+}
+
+// Fixpoint returns a pass which runs passes repeatedly, until the number of instructions does not decrease.
+func Fixpoint(passes ...Pass) Pass {
+	return fixpoint{passes: append([]Pass{}, passes...)}
+}
+
+// Name implements the Pass interface.
+func (f fixpoint) Name() string {
+	r := "Fixpoint("
+	for i, p := range f.passes {
+		if i > 0 {
+			r += ", "
+		}
+		r += p.Name()
+	}
+
+	return r + ")"
+}
+
+// Run implements the Pass interface.
+func (f fixpoint) Run(insts []qsim.Instruction) []qsim.Instruction {
+	for {
+		n := len(insts)
+		for _, p := range f.passes {
+			insts = p.Run(insts)
+		}
+
+		if len(insts) >= n {
+			return insts
+		}
+	}
+}
+
+// Optimize returns a PassManager which translates circuits to basis, and then
+// removes identities, cancels inverses and merges rotations until no more gates are removed.
+func Optimize(basis ...string) *PassManager {
+	return NewPassManager(
+		BasisTranslation(basis...),
+		Fixpoint(RemoveIdentities(), CancelInverses(), MergeRotations(), CommutativeCancellation()),
+	)
+}
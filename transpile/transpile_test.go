@@ -0,0 +1,329 @@
+package transpile_test
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/sp301415/qsim"
+	"github.com/sp301415/qsim/math/mat"
+	"github.com/sp301415/qsim/transpile"
+	"github.com/sp301415/qsim/utils/slice"
+)
+
+// equalsUpToPhase checks if a = exp(i phi) b for some phi.
+func equalsUpToPhase(a, b mat.Mat) bool {
+	bi, bj := 0, 0
+	for i := range b {
+		for j := range b[i] {
+			if cmplx.Abs(b[i][j]) > cmplx.Abs(b[bi][bj]) {
+				bi, bj = i, j
+			}
+		}
+	}
+
+	return a.Equals(b.ScalarMul(a[bi][bj] / b[bi][bj]))
+}
+
+// sample returns a circuit with various gates.
+func sample() *qsim.Circuit {
+	c := qsim.NewCircuit(3)
+	c.H(0, 1)
+	c.X(2)
+	c.CX(0, 1)
+	c.P(0.3, 2)
+	c.CCX(0, 1, 2)
+	c.Control(qsim.P(math.Pi/3), []int{2}, []int{0})
+	c.Swap(0, 2)
+	c.Apply(qsim.SX(), 1)
+	c.Apply(qsim.H().Tensor(qsim.T()), 1, 2)
+	c.U3(0.1, 0.2, 0.3, 0)
+	c.RY(0.7, 1)
+	c.QFT(0, 1, 2)
+
+	return c
+}
+
+func TestBasisTranslation(t *testing.T) {
+	bases := [][]string{
+		{"CX", "RZ", "SX", "X"},
+		{"CX", "RZ", "SX"},
+		{"CX", "U3"},
+		{"CZ", "RZ", "RY"},
+		{"CX", "RZ", "RX", "H"},
+	}
+
+	c := sample()
+	want := c.Unitary(false)
+
+	for _, basis := range bases {
+		allowed := map[string]bool{}
+		for _, b := range basis {
+			allowed[b] = true
+		}
+
+		r := transpile.NewPassManager(transpile.BasisTranslation(basis...)).Run(c)
+		for _, inst := range r.Instructions() {
+			name := inst.Gate.Name()
+			if len(inst.Controls) == 1 {
+				name = "C" + name
+			}
+			if len(inst.Controls) > 1 || !allowed[name] {
+				t.Fatalf("%v: %v", basis, name)
+			}
+		}
+
+		if !equalsUpToPhase(r.Unitary(false), want) {
+			t.Fatalf("%v", basis)
+		}
+	}
+
+	// Anti-diagonal gates use X.
+	for _, g := range []qsim.Gate{qsim.X(), qsim.Y(), qsim.U3(math.Pi, 0.3, 1.1)} {
+		c := qsim.NewCircuit(1)
+		c.Apply(g, 0)
+		r := transpile.NewPassManager(transpile.BasisTranslation("CX", "RZ", "SX", "X")).Run(c)
+		if !equalsUpToPhase(r.Unitary(false), g.ToMat()) || r.Metrics().Counts["SX"] != 0 {
+			t.Fatalf("%v", g)
+		}
+	}
+}
+
+func TestPeephole(t *testing.T) {
+	c := qsim.NewCircuit(3)
+	c.H(0)
+	c.H(0)
+	c.CX(0, 1)
+	c.CX(0, 1)
+	c.P(0.2, 2)
+	c.P(0.3, 2)
+	c.I(1)
+	c.RZ(2*math.Pi, 1)
+	c.T(0)
+	c.Apply(qsim.T().Dagger(), 0)
+	c.Control(qsim.P(0.1), []int{0}, []int{1})
+	c.Control(qsim.P(0.4), []int{0}, []int{1})
+
+	cases := []struct {
+		pass transpile.Pass
+		size int
+	}{
+		{transpile.RemoveIdentities(), 10},
+		{transpile.CancelInverses(), 4},
+		{transpile.MergeRotations(), 10},
+		{transpile.Fixpoint(transpile.RemoveIdentities(), transpile.CancelInverses(), transpile.MergeRotations()), 2},
+	}
+
+	want := c.Unitary(false)
+	for _, tc := range cases {
+		r := transpile.NewPassManager(tc.pass).Run(c)
+		if len(r.Instructions()) != tc.size {
+			t.Fatalf("%v: %d", tc.pass.Name(), len(r.Instructions()))
+		}
+		if !equalsUpToPhase(r.Unitary(false), want) {
+			t.Fatalf("%v", tc.pass.Name())
+		}
+	}
+}
+
+func TestCommutativeCancellation(t *testing.T) {
+	c := qsim.NewCircuit(2)
+	c.CX(0, 1)
+	c.RZ(0.5, 0)
+	c.X(1)
+	c.CX(0, 1)
+	c.RZ(-0.5, 0)
+	c.Barrier()
+	c.H(0)
+	c.Barrier(0)
+	c.H(0)
+
+	r := transpile.NewPassManager(transpile.CommutativeCancellation()).Run(c)
+	if len(r.Instructions()) != 5 {
+		t.Fatalf("%v", r.Draw())
+	}
+	if !equalsUpToPhase(r.Unitary(false), c.Unitary(false)) {
+		t.Fail()
+	}
+
+	// Barriers block cancellation.
+	if r.Metrics().Counts["H"] != 2 {
+		t.Fail()
+	}
+}
+
+func TestMergeNamedRotations(t *testing.T) {
+	c := qsim.NewCircuit(1)
+	c.Apply(qsim.NewNamedGate("RZ", qsim.RZ(0.3).ToMat()), 0)
+	c.Apply(qsim.NewNamedGate("RZ", qsim.RZ(0.4).ToMat()), 0)
+
+	for _, p := range []transpile.Pass{transpile.MergeRotations(), transpile.CommutativeCancellation()} {
+		r := transpile.NewPassManager(p).Run(c)
+		if len(r.Instructions()) != 2 {
+			t.Fatalf("%v", p.Name())
+		}
+		if !equalsUpToPhase(r.Unitary(false), c.Unitary(false)) {
+			t.Fatalf("%v", p.Name())
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	c := sample()
+	c.Append(c.Inverse(), nil)
+
+	pm := transpile.Optimize("CX", "RZ", "SX", "X")
+	r := pm.Run(c)
+
+	if !equalsUpToPhase(r.Unitary(false), c.Unitary(false)) {
+		t.Fail()
+	}
+
+	if len(r.Instructions()) >= len(transpile.NewPassManager(transpile.BasisTranslation("CX", "RZ", "SX", "X")).Run(c).Instructions()) {
+		t.Fail()
+	}
+
+	if len(pm.Passes()) != 2 {
+		t.Fail()
+	}
+}
+
+func TestCouplingMap(t *testing.T) {
+	cases := []struct {
+		cm    *transpile.CouplingMap
+		size  int
+		edges int
+		dist  int
+	}{
+		{transpile.Line(5), 5, 4, 4},
+		{transpile.Ring(5), 5, 5, 1},
+		{transpile.Grid(2, 3), 6, 7, 3},
+		{transpile.HeavyHex(1, 1), 16, 16, 7},
+	}
+
+	for _, tc := range cases {
+		if tc.cm.Size() != tc.size || len(tc.cm.Edges()) != tc.edges {
+			t.Fatalf("%d %d", tc.cm.Size(), len(tc.cm.Edges()))
+		}
+
+		if d := tc.cm.Distance(0, tc.size-1); d != tc.dist || len(tc.cm.ShortestPath(0, tc.size-1)) != d+1 {
+			t.Fatalf("%d", d)
+		}
+	}
+
+	// Heavy-hex lattice has qubits of degree at most 3.
+	cm := transpile.HeavyHex(2, 2)
+	for q := 0; q < cm.Size(); q++ {
+		if len(cm.Neighbors(q)) > 3 {
+			t.Fatalf("%d", q)
+		}
+	}
+}
+
+// checkRouting checks if every two qubit gate of r acts on connected qubits,
+// and r is the same as c with layouts.
+func checkRouting(t *testing.T, c, r *qsim.Circuit, cm *transpile.CouplingMap, rt *transpile.Routing) {
+	for _, inst := range r.Instructions() {
+		qs := append(append([]int{}, inst.Controls...), inst.Targets...)
+		if len(qs) == 2 && !cm.Connected(qs[0], qs[1]) {
+			t.Fatalf("%v: %v", rt.Name(), qs)
+		}
+	}
+
+	permute := func(x int, layout []int) int {
+		y := 0
+		for i, p := range layout {
+			y |= (x >> i & 1) << p
+		}
+		return y
+	}
+
+	// r P_initial = P_final c.
+	uc, ur := c.Unitary(false), r.Unitary(false)
+	initial, final := rt.InitialLayout(), rt.FinalLayout()
+	m := mat.NewSquare(len(uc))
+	for x := range uc {
+		for y := range uc {
+			m[permute(x, final)][permute(y, initial)] = uc[x][y]
+		}
+	}
+
+	if !ur.Equals(m) {
+		t.Fatalf("%v", rt.Name())
+	}
+}
+
+func TestRouting(t *testing.T) {
+	c := qsim.NewCircuit(5)
+	c.H(0, 1, 2)
+	c.CX(0, 4)
+	c.CX(3, 1)
+	c.Control(qsim.P(0.3), []int{2}, []int{4})
+	c.Swap(0, 2)
+	c.RY(0.4, 3)
+	c.CX(4, 1)
+	c.Barrier()
+	c.CX(0, 3)
+	c.CX(2, 4)
+
+	for _, cm := range []*transpile.CouplingMap{transpile.Line(5), transpile.Ring(5)} {
+		for _, rt := range []*transpile.Routing{transpile.BasicSwap(cm), transpile.Sabre(cm)} {
+			r := transpile.NewPassManager(rt).Run(c)
+			checkRouting(t, c, r, cm, rt)
+
+			if rt.Swaps() == 0 {
+				t.Fatalf("%v", rt.Name())
+			}
+		}
+	}
+}
+
+func TestRoutingLarge(t *testing.T) {
+	// Route QFT on devices too large to simulate, using recorders.
+	for _, cm := range []*transpile.CouplingMap{transpile.Line(16), transpile.Grid(4, 4), transpile.HeavyHex(1, 2)} {
+		c := qsim.NewRecorder(cm.Size())
+		c.QFT(slice.Range(0, 8)...)
+		c.CX(0, 7)
+
+		basic, sabre := transpile.BasicSwap(cm), transpile.Sabre(cm)
+		transpile.NewPassManager(basic).Run(c)
+		r := transpile.NewPassManager(sabre).Run(c)
+
+		for _, inst := range r.Instructions() {
+			qs := append(append([]int{}, inst.Controls...), inst.Targets...)
+			if len(qs) == 2 && !cm.Connected(qs[0], qs[1]) {
+				t.Fatalf("%v", qs)
+			}
+		}
+
+		if sabre.Swaps() >= basic.Swaps() {
+			t.Fatalf("%d qubits: SABRE %d swaps, basic %d swaps", cm.Size(), sabre.Swaps(), basic.Swaps())
+		}
+	}
+}
+
+func TestRoutingSize(t *testing.T) {
+	// Circuits smaller than the coupling map are rejected, instead of referring to missing qubits.
+	cm := transpile.HeavyHex(1, 1)
+	for _, c := range []*qsim.Circuit{qsim.NewRecorder(4), qsim.NewCircuit(4)} {
+		c.CX(0, 3)
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fail()
+				}
+			}()
+			transpile.NewPassManager(transpile.Sabre(cm)).Run(c)
+		}()
+	}
+
+	// Rebuild checks registers of instructions.
+	c := qsim.NewRecorder(cm.Size())
+	c.CX(8, 10)
+	defer func() {
+		if recover() == nil {
+			t.Fail()
+		}
+	}()
+	qsim.NewRecorder(4).Rebuild(c.Instructions())
+}
@@ -0,0 +1,60 @@
+package qsim
+
+import (
+	"math/cmplx"
+
+	"github.com/sp301415/qsim/math/mat"
+)
+
+// Unitary returns the 2^n x 2^n unitary matrix of recorded instructions,
+// computed by running them on every basis state. Bit i of row and column indices is qubit i,
+// same as the matrix of a gate applied with Apply(op, 0, 1, ..., n-1).
+// If normalize is true, global phase is removed so that the largest entry of the first column is real and positive.
+// Panics if the circuit has measurements, resets or classical conditions.
+func (c *Circuit) Unitary(normalize bool) mat.Mat {
+	for _, inst := range c.insts {
+		if inst.Kind == KindMeasure || inst.Kind == KindReset {
+			panic("Circuit with measurements or resets is not unitary.")
+		}
+
+		if inst.Cond != nil {
+			panic("Circuit with classical conditions is not unitary.")
+		}
+	}
+
+	n := 1 << c.Size()
+	r := &Circuit{
+		size:   c.Size(),
+		Option: c.Option,
+	}
+	defer r.Close()
+
+	plan := c.Plan()
+	m := mat.NewSquare(n)
+	for k := 0; k < n; k++ {
+		r.state = newState(k, c.Size(), Options{})
+		for _, inst := range plan {
+			r.run(inst)
+		}
+		m.SetCol(k, r.state.qubit().data)
+	}
+
+	if normalize {
+		col := m.GetCol(0)
+		best := 0
+		for i, a := range col {
+			if cmplx.Abs(a) > cmplx.Abs(col[best]) {
+				best = i
+			}
+		}
+		m = m.ScalarMul(cmplx.Conj(col[best]) / complex(cmplx.Abs(col[best]), 0))
+	}
+
+	return m
+}
+
+// ToGate returns the recorded instructions as a gate, using NewGate.
+// The gate acts on qubits in order, so Apply(c.ToGate(), iregs...) maps qubit i of c to iregs[i].
+func (c *Circuit) ToGate() Gate {
+	return NewGate(c.Unitary(false))
+}